@@ -8,6 +8,15 @@ import (
 )
 
 func CreateACL(c *cli.Context) {
+	rules, _, err := aclRulesFromContext(c, "")
+	if err != nil {
+		log.Errorf("Could not load rules: %v", err)
+		log.Exit(2)
+	}
+	if !validateACLRules(c, rules) {
+		log.Exit(2)
+	}
+
 	cfg, err := NewAppConfig(c)
 	if err != nil {
 		log.Errorf("Failed to get client: %v", err)
@@ -17,7 +26,7 @@ func CreateACL(c *cli.Context) {
 	t, _, err := cfg.client.ACL().Create(&api.ACLEntry{
 		Name:  c.String("name"),
 		Type:  c.String("type"),
-		Rules: c.Args().First(),
+		Rules: rules,
 		ID:    c.String("id"),
 	}, cfg.writeOpts)
 
@@ -30,10 +39,19 @@ func CreateACL(c *cli.Context) {
 }
 
 func UpdateACL(c *cli.Context) {
-	if len(c.String("id")) > 1 {
+	if len(c.String("id")) < 1 {
 		log.Errorln("--id is required!")
 		cli.ShowAppHelp(c)
-		return
+		log.Exit(2)
+	}
+
+	rules, _, err := aclRulesFromContext(c, "")
+	if err != nil {
+		log.Errorf("Could not load rules: %v", err)
+		log.Exit(2)
+	}
+	if !validateACLRules(c, rules) {
+		log.Exit(2)
 	}
 
 	cfg, err := NewAppConfig(c)
@@ -45,7 +63,7 @@ func UpdateACL(c *cli.Context) {
 	_, err = cfg.client.ACL().Update(&api.ACLEntry{
 		Name:  c.String("name"),
 		Type:  c.String("type"),
-		Rules: c.Args().First(),
+		Rules: rules,
 		ID:    c.String("id"),
 	}, cfg.writeOpts)
 
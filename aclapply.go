@@ -0,0 +1,456 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The built in global-management policy is never pruned
+const globalManagementPolicyID = "00000000-0000-0000-0000-000000000001"
+
+// The anonymous token is never matched to a token in the file
+const anonymousTokenID = "00000000-0000-0000-0000-000000000002"
+
+// aclApplyFile is the desired ACL state read by acl apply
+type aclApplyFile struct {
+	Policies []*aclApplyPolicy `yaml:"policies"`
+	Roles    []*aclApplyRole   `yaml:"roles"`
+	Tokens   []*aclApplyToken  `yaml:"tokens"`
+}
+
+type aclApplyPolicy struct {
+	Name        string   `yaml:"name"`
+	Description string   `yaml:"description"`
+	Rules       string   `yaml:"rules"`
+	RulesFile   string   `yaml:"rules_file"`
+	Datacenters []string `yaml:"datacenters"`
+}
+
+type aclApplyRole struct {
+	Name              string   `yaml:"name"`
+	Description       string   `yaml:"description"`
+	Policies          []string `yaml:"policies"`
+	ServiceIdentities []string `yaml:"service_identities"`
+	NodeIdentities    []string `yaml:"node_identities"`
+}
+
+// aclApplyToken is matched to existing tokens by its accessor ID if it
+// pins one, otherwise by its description, since tokens don't have names
+type aclApplyToken struct {
+	AccessorID        string   `yaml:"accessor_id"`
+	Description       string   `yaml:"description"`
+	Policies          []string `yaml:"policies"`
+	Roles             []string `yaml:"roles"`
+	ServiceIdentities []string `yaml:"service_identities"`
+	NodeIdentities    []string `yaml:"node_identities"`
+	Local             bool     `yaml:"local"`
+}
+
+// aclApplyStep is one planned change and the function that makes it
+type aclApplyStep struct {
+	Op      string
+	Kind    string
+	Name    string
+	Details string
+	apply   func() error
+}
+
+func ApplyACL(c *cli.Context) {
+	if len(c.String("file")) < 1 {
+		log.Errorln("--file is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	desired, err := loadACLApplyFile(c.String("file"), c.Bool("skip-lint"))
+	if err != nil {
+		log.Fatalf("Could not load %s: %v", c.String("file"), err)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	plan := []*aclApplyStep{}
+	steps, err := planACLPolicies(cfg, desired.Policies, c.Bool("prune"))
+	if err != nil {
+		log.Fatalf("Could not read policies: %v", err)
+	}
+	plan = append(plan, steps...)
+	if steps, err = planACLRoles(cfg, desired.Roles, c.GlobalString("datacenter")); err != nil {
+		log.Fatalf("Could not read roles: %v", err)
+	}
+	plan = append(plan, steps...)
+	if steps, err = planACLTokens(cfg, desired.Tokens, c.GlobalString("datacenter"), c.Bool("show-secrets")); err != nil {
+		log.Fatalf("Could not read tokens: %v", err)
+	}
+	plan = append(plan, steps...)
+
+	// Deletes go last so roles and tokens are updated to drop a
+	// policy before it's pruned
+	sort.SliceStable(plan, func(i, j int) bool { return plan[i].Op != "-" && plan[j].Op == "-" })
+
+	if len(plan) < 1 {
+		log.Println("ACLs are up to date")
+		return
+	}
+
+	w := getTabwriter()
+	for _, s := range plan {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.Op, s.Kind, s.Name, s.Details)
+	}
+	w.Flush()
+
+	if c.Bool("dry-run") {
+		return
+	}
+
+	// Policies are created first so roles and tokens can link to them by
+	// name, a failure stops the run so later steps don't reference missing objects
+	for _, s := range plan {
+		if err := s.apply(); err != nil {
+			log.Fatalf("Could not %s %s %s: %v", aclApplyVerbs[s.Op], s.Kind, s.Name, err)
+		}
+	}
+	log.Println("Success")
+}
+
+var aclApplyVerbs = map[string]string{"+": "create", "~": "update", "-": "delete"}
+
+func loadACLApplyFile(path string, skipLint bool) (*aclApplyFile, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	desired := &aclApplyFile{}
+	if err = yaml.Unmarshal(fileBytes, desired); err != nil {
+		return nil, err
+	}
+
+	for _, p := range desired.Policies {
+		if len(p.Name) < 1 {
+			return nil, fmt.Errorf("policy without a name")
+		}
+		// rules_file is relative to the apply file so the repo can move around
+		if len(p.RulesFile) > 0 {
+			rulesPath := p.RulesFile
+			if !filepath.IsAbs(rulesPath) {
+				rulesPath = filepath.Join(filepath.Dir(path), rulesPath)
+			}
+			b, err := ioutil.ReadFile(rulesPath)
+			if err != nil {
+				return nil, fmt.Errorf("policy %s: %v", p.Name, err)
+			}
+			p.Rules = string(b)
+		}
+		if skipLint {
+			continue
+		}
+		_, findings := checkACLRules(p.Rules)
+		for _, f := range findings {
+			if f.Level == "error" {
+				return nil, fmt.Errorf("policy %s: %s", p.Name, f)
+			}
+			log.Warnf("policy %s: %s", p.Name, f)
+		}
+	}
+	for _, r := range desired.Roles {
+		if len(r.Name) < 1 {
+			return nil, fmt.Errorf("role without a name")
+		}
+	}
+	descriptions := map[string]bool{}
+	accessors := map[string]bool{}
+	for _, t := range desired.Tokens {
+		if len(t.Description) < 1 {
+			return nil, fmt.Errorf("token without a description")
+		}
+		if descriptions[t.Description] {
+			return nil, fmt.Errorf("more than one token with description %q", t.Description)
+		}
+		descriptions[t.Description] = true
+		if len(t.AccessorID) > 0 {
+			if !uuidPattern.MatchString(t.AccessorID) {
+				return nil, fmt.Errorf("token %q: accessor_id must be a UUID", t.Description)
+			}
+			if accessors[t.AccessorID] || t.AccessorID == anonymousTokenID {
+				return nil, fmt.Errorf("token %q: accessor_id %s can't be used", t.Description, t.AccessorID)
+			}
+			accessors[t.AccessorID] = true
+		}
+	}
+	return desired, nil
+}
+
+func planACLPolicies(cfg *AppConfig, desired []*aclApplyPolicy, prune bool) ([]*aclApplyStep, error) {
+	acl := cfg.client.ACL()
+	existing, _, err := acl.PolicyList(cfg.queryOpts)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*api.ACLPolicyListEntry{}
+	for _, p := range existing {
+		byName[p.Name] = p
+	}
+
+	steps := []*aclApplyStep{}
+	managed := map[string]bool{}
+	for _, want := range desired {
+		managed[want.Name] = true
+		policy := &api.ACLPolicy{
+			Name:        want.Name,
+			Description: want.Description,
+			Rules:       want.Rules,
+			Datacenters: want.Datacenters,
+		}
+
+		entry, ok := byName[want.Name]
+		if !ok {
+			steps = append(steps, &aclApplyStep{Op: "+", Kind: "policy", Name: want.Name, apply: func() error {
+				_, _, err := acl.PolicyCreate(policy, cfg.writeOpts)
+				return err
+			}})
+			continue
+		}
+
+		have, _, err := acl.PolicyRead(entry.ID, cfg.queryOpts)
+		if err != nil {
+			return nil, err
+		}
+		diff := []string{}
+		if have.Description != want.Description {
+			diff = append(diff, "description")
+		}
+		if strings.TrimSpace(have.Rules) != strings.TrimSpace(want.Rules) {
+			diff = append(diff, "rules")
+		}
+		if !stringSetsEqual(have.Datacenters, want.Datacenters) {
+			diff = append(diff, "datacenters")
+		}
+		if len(diff) > 0 {
+			policy.ID = have.ID
+			steps = append(steps, &aclApplyStep{Op: "~", Kind: "policy", Name: want.Name, Details: strings.Join(diff, ", "), apply: func() error {
+				_, _, err := acl.PolicyUpdate(policy, cfg.writeOpts)
+				return err
+			}})
+		}
+	}
+
+	if prune {
+		pruned := []*aclApplyStep{}
+		for _, p := range existing {
+			if managed[p.Name] || p.ID == globalManagementPolicyID {
+				continue
+			}
+			id := p.ID
+			pruned = append(pruned, &aclApplyStep{Op: "-", Kind: "policy", Name: p.Name, apply: func() error {
+				_, err := acl.PolicyDelete(id, cfg.writeOpts)
+				return err
+			}})
+		}
+		sort.Slice(pruned, func(i, j int) bool { return pruned[i].Name < pruned[j].Name })
+		steps = append(steps, pruned...)
+	}
+	return steps, nil
+}
+
+func planACLRoles(cfg *AppConfig, desired []*aclApplyRole, dc string) ([]*aclApplyStep, error) {
+	acl := cfg.client.ACL()
+	existing, _, err := acl.RoleList(cfg.queryOpts)
+	if err != nil {
+		return nil, err
+	}
+	byName := map[string]*api.ACLRole{}
+	for _, r := range existing {
+		byName[r.Name] = r
+	}
+
+	steps := []*aclApplyStep{}
+	for _, want := range desired {
+		svcIDs, err := parseServiceIdentities(want.ServiceIdentities)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %v", want.Name, err)
+		}
+		nodeIDs, err := parseNodeIdentities(want.NodeIdentities, dc)
+		if err != nil {
+			return nil, fmt.Errorf("role %s: %v", want.Name, err)
+		}
+		role := &api.ACLRole{
+			Name:              want.Name,
+			Description:       want.Description,
+			Policies:          aclLinks(want.Policies),
+			ServiceIdentities: svcIDs,
+			NodeIdentities:    nodeIDs,
+		}
+
+		have, ok := byName[want.Name]
+		if !ok {
+			steps = append(steps, &aclApplyStep{Op: "+", Kind: "role", Name: want.Name, apply: func() error {
+				_, _, err := acl.RoleCreate(role, cfg.writeOpts)
+				return err
+			}})
+			continue
+		}
+
+		diff := diffACLIdentities(have.Policies, role.Policies, have.ServiceIdentities, svcIDs, have.NodeIdentities, nodeIDs)
+		if have.Description != want.Description {
+			diff = append([]string{"description"}, diff...)
+		}
+		if len(diff) > 0 {
+			role.ID = have.ID
+			steps = append(steps, &aclApplyStep{Op: "~", Kind: "role", Name: want.Name, Details: strings.Join(diff, ", "), apply: func() error {
+				_, _, err := acl.RoleUpdate(role, cfg.writeOpts)
+				return err
+			}})
+		}
+	}
+	return steps, nil
+}
+
+func planACLTokens(cfg *AppConfig, desired []*aclApplyToken, dc string, showSecrets bool) ([]*aclApplyStep, error) {
+	acl := cfg.client.ACL()
+	existing, _, err := acl.TokenList(cfg.queryOpts)
+	if err != nil {
+		return nil, err
+	}
+	// A description shared by several tokens can't say which one is
+	// meant, so refuse rather than update the wrong one. The anonymous
+	// token is never matched.
+	byAccessor := map[string]*api.ACLTokenListEntry{}
+	byDescription := map[string]*api.ACLTokenListEntry{}
+	duplicated := map[string]bool{}
+	for _, t := range existing {
+		byAccessor[t.AccessorID] = t
+		if t.AccessorID == anonymousTokenID || len(t.Description) < 1 {
+			continue
+		}
+		if _, ok := byDescription[t.Description]; ok {
+			duplicated[t.Description] = true
+		}
+		byDescription[t.Description] = t
+	}
+	for _, want := range desired {
+		if len(want.AccessorID) < 1 && duplicated[want.Description] {
+			return nil, fmt.Errorf("token %q: several tokens have this description, pin one with accessor_id", want.Description)
+		}
+	}
+
+	steps := []*aclApplyStep{}
+	for _, want := range desired {
+		svcIDs, err := parseServiceIdentities(want.ServiceIdentities)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %v", want.Description, err)
+		}
+		nodeIDs, err := parseNodeIdentities(want.NodeIdentities, dc)
+		if err != nil {
+			return nil, fmt.Errorf("token %s: %v", want.Description, err)
+		}
+		token := &api.ACLToken{
+			AccessorID:        want.AccessorID,
+			Description:       want.Description,
+			Policies:          aclLinks(want.Policies),
+			Roles:             aclLinks(want.Roles),
+			ServiceIdentities: svcIDs,
+			NodeIdentities:    nodeIDs,
+			Local:             want.Local,
+		}
+
+		have, ok := byDescription[want.Description]
+		if len(want.AccessorID) > 0 {
+			// Pinned tokens are created with that accessor if they don't exist
+			have, ok = byAccessor[want.AccessorID]
+		}
+		if !ok {
+			steps = append(steps, &aclApplyStep{Op: "+", Kind: "token", Name: want.Description, apply: func() error {
+				t, _, err := acl.TokenCreate(token, cfg.writeOpts)
+				if err != nil {
+					return err
+				}
+				secret := "<hidden, use --show-secrets>"
+				if showSecrets {
+					secret = t.SecretID
+				}
+				log.Infof("Created token %q AccessorID=%s SecretID=%s", t.Description, t.AccessorID, secret)
+				return nil
+			}})
+			continue
+		}
+
+		diff := diffACLIdentities(have.Policies, token.Policies, have.ServiceIdentities, svcIDs, have.NodeIdentities, nodeIDs)
+		if !aclLinksEqual(have.Roles, token.Roles) {
+			diff = append(diff, "roles")
+		}
+		if have.Description != want.Description {
+			diff = append([]string{"description"}, diff...)
+		}
+		if have.Local != want.Local {
+			log.Warnf("Token %q: local can't be changed after creation", want.Description)
+		}
+		if len(diff) > 0 {
+			token.AccessorID = have.AccessorID
+			token.Local = have.Local
+			steps = append(steps, &aclApplyStep{Op: "~", Kind: "token", Name: want.Description, Details: strings.Join(diff, ", "), apply: func() error {
+				_, _, err := acl.TokenUpdate(token, cfg.writeOpts)
+				return err
+			}})
+		}
+	}
+	return steps, nil
+}
+
+// diffACLIdentities names which of the policy links and identities differ
+func diffACLIdentities(havePolicies, wantPolicies []*api.ACLLink,
+	haveSvc, wantSvc []*api.ACLServiceIdentity, haveNode, wantNode []*api.ACLNodeIdentity) []string {
+	diff := []string{}
+	if !aclLinksEqual(havePolicies, wantPolicies) {
+		diff = append(diff, "policies")
+	}
+	if formatServiceIdentities(sortedServiceIdentities(haveSvc)) != formatServiceIdentities(sortedServiceIdentities(wantSvc)) {
+		diff = append(diff, "service identities")
+	}
+	if formatNodeIdentities(sortedNodeIdentities(haveNode)) != formatNodeIdentities(sortedNodeIdentities(wantNode)) {
+		diff = append(diff, "node identities")
+	}
+	return diff
+}
+
+// aclLinksEqual compares links read from Consul, which have both an ID and
+// a name, with wanted links that have one or the other
+func aclLinksEqual(have, want []*api.ACLLink) bool {
+	if len(have) != len(want) {
+		return false
+	}
+	for _, w := range want {
+		found := false
+		for _, h := range have {
+			if (len(w.ID) > 0 && w.ID == h.ID) || (len(w.Name) > 0 && w.Name == h.Name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func sortedServiceIdentities(ids []*api.ACLServiceIdentity) []*api.ACLServiceIdentity {
+	sorted := append([]*api.ACLServiceIdentity{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ServiceName < sorted[j].ServiceName })
+	return sorted
+}
+
+func sortedNodeIdentities(ids []*api.ACLNodeIdentity) []*api.ACLNodeIdentity {
+	sorted := append([]*api.ACLNodeIdentity{}, ids...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].NodeName < sorted[j].NodeName })
+	return sorted
+}
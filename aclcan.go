@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+// Higher wins when rules for the same segment come from several policies
+var aclPolicyPrecedence = map[string]int{"read": 1, "list": 2, "write": 3, "deny": 4}
+
+// aclGrant is a rule along with where the token got it from
+type aclGrant struct {
+	Rule   *aclRule
+	Source string
+}
+
+func (g *aclGrant) String() string {
+	if g.Rule.Line > 0 {
+		return fmt.Sprintf("%s: %s = %q (line %d)", g.Source, g.Rule, g.Rule.Policy, g.Rule.Line)
+	}
+	return fmt.Sprintf("%s: %s = %q", g.Source, g.Rule, g.Rule.Policy)
+}
+
+// aclCheck is a single operation to test, e.g. key:write app/config/db
+type aclCheck struct {
+	Resource string
+	Access   string
+	Segment  string
+}
+
+func (a *aclCheck) String() string {
+	if len(a.Segment) > 0 {
+		return fmt.Sprintf("%s:%s %s", a.Resource, a.Access, a.Segment)
+	}
+	return fmt.Sprintf("%s:%s", a.Resource, a.Access)
+}
+
+// ACLCan evaluates a token's rules locally and reports whether it allows
+// an operation, and which rule decided it. Exits 1 if anything is denied.
+func ACLCan(c *cli.Context) {
+	checks := []*aclCheck{}
+	if path := c.String("file"); len(path) > 0 {
+		var err error
+		if checks, err = loadACLChecks(path); err != nil {
+			log.Errorf("Could not load checks: %v", err)
+			log.Exit(2)
+		}
+	} else {
+		check, err := parseACLCheck(c.Args().First(), c.Args().Get(1))
+		if err != nil {
+			log.Errorln(err)
+			cli.ShowAppHelp(c)
+			log.Exit(2)
+		}
+		checks = append(checks, check)
+	}
+
+	defaultPolicy := c.String("default-policy")
+	if defaultPolicy != "allow" && defaultPolicy != "deny" {
+		log.Errorf("--default-policy must be allow or deny")
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	// The command's --token is the one being checked, the global one is
+	// still used for requests. An application token can read itself but
+	// rarely its policies and roles, so only the token is read with it.
+	var token *api.ACLToken
+	switch {
+	case len(c.String("token")) > 0:
+		opts := *cfg.queryOpts
+		opts.Token = c.String("token")
+		token, _, err = cfg.client.ACL().TokenReadSelf(&opts)
+	case len(c.String("accessor")) > 0:
+		token, err = readToken(cfg, c.String("accessor"))
+	default:
+		token, err = readToken(cfg, "self")
+	}
+	if err != nil {
+		log.Fatalf("Could not read token: %v", err)
+	}
+	info, err := resolveTokenInfo(cfg, token)
+	if err != nil {
+		log.Fatalf("Could not read the token's policies and roles: %v", err)
+	}
+	grants, management := collectACLGrants(info)
+
+	denied := 0
+	w := getTabwriter()
+	fmt.Fprintf(w, "Check\tResult\tRule\n")
+	for _, check := range checks {
+		allowed, reason := defaultPolicy == "allow", fmt.Sprintf("no matching rule, default policy %s", defaultPolicy)
+		if management {
+			allowed, reason = true, "global-management"
+		} else if g := matchACLGrant(grants, check); g != nil {
+			allowed, reason = aclPolicyAllows(g.Rule.Policy, check.Access), g.String()
+		}
+
+		result := "allow"
+		if !allowed {
+			result = "deny"
+			denied++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", check, result, reason)
+	}
+	w.Flush()
+
+	if denied > 0 {
+		log.Exit(1)
+	}
+}
+
+// parseACLCheck parses resource:access and the segment it applies to
+func parseACLCheck(spec, segment string) (*aclCheck, error) {
+	split := strings.SplitN(spec, ":", 2)
+	if len(split) != 2 {
+		return nil, fmt.Errorf("%q must look like resource:access, e.g. key:write", spec)
+	}
+	check := &aclCheck{Resource: split[0], Access: split[1], Segment: segment}
+
+	switch {
+	case stringArrayContains(check.Resource, aclScalarResources):
+		check.Segment = ""
+	case stringArrayContains(check.Resource, aclSegmentedResources):
+		// An empty segment is valid, it's how the root of the KV is checked
+	default:
+		return nil, fmt.Errorf("unknown resource %s", check.Resource)
+	}
+	if check.Access != "read" && check.Access != "write" && check.Access != "list" {
+		return nil, fmt.Errorf("access must be read, write or list, not %s", check.Access)
+	}
+	return check, nil
+}
+
+// loadACLChecks reads one check per line, blank lines and # comments are skipped
+func loadACLChecks(path string) ([]*aclCheck, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	checks := []*aclCheck{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) < 1 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		segment := ""
+		if len(fields) > 1 {
+			segment = fields[1]
+		}
+		check, err := parseACLCheck(fields[0], segment)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n, err)
+		}
+		checks = append(checks, check)
+	}
+	return checks, scanner.Err()
+}
+
+// collectACLGrants gathers the rules of every effective policy plus the
+// ones Consul generates for service and node identities. Returns true
+// if the token has global-management, which allows everything.
+func collectACLGrants(info *tokenInfo) ([]*aclGrant, bool) {
+	grants := []*aclGrant{}
+	add := func(source string, rules ...*aclRule) {
+		for _, r := range rules {
+			grants = append(grants, &aclGrant{Rule: r, Source: source})
+		}
+	}
+
+	for _, p := range info.Policies {
+		if p.Policy.ID == globalManagementPolicyID {
+			return nil, true
+		}
+		rules, _, err := parseACLRules(p.Policy.Rules)
+		if err != nil {
+			log.Warnf("Could not parse rules of policy %s, ignoring it: %v", p.Policy.Name, err)
+			continue
+		}
+		add("policy "+p.Policy.Name, rules...)
+	}
+
+	for _, id := range info.ServiceIdentities {
+		add("service identity "+id.ServiceName,
+			&aclRule{Resource: "service", Segment: id.ServiceName, Policy: "write"},
+			&aclRule{Resource: "service", Segment: id.ServiceName + "-sidecar-proxy", Policy: "write"},
+			&aclRule{Resource: "service_prefix", Segment: "", Policy: "read"},
+			&aclRule{Resource: "node_prefix", Segment: "", Policy: "read"},
+		)
+	}
+	for _, id := range info.NodeIdentities {
+		add("node identity "+id.NodeName,
+			&aclRule{Resource: "node", Segment: id.NodeName, Policy: "write"},
+			&aclRule{Resource: "service_prefix", Segment: "", Policy: "read"},
+		)
+	}
+	return grants, false
+}
+
+// matchACLGrant finds the rule Consul would apply: an exact match beats
+// any prefix, a longer prefix beats a shorter one, and when policies
+// disagree on the same segment the stronger policy (deny first) wins
+func matchACLGrant(grants []*aclGrant, check *aclCheck) *aclGrant {
+	var best *aclGrant
+	better := func(g *aclGrant) bool {
+		if best == nil {
+			return true
+		}
+		if best.Rule.Prefix() != g.Rule.Prefix() {
+			return !g.Rule.Prefix()
+		}
+		if len(g.Rule.Segment) != len(best.Rule.Segment) {
+			return len(g.Rule.Segment) > len(best.Rule.Segment)
+		}
+		return aclPolicyPrecedence[g.Rule.Policy] > aclPolicyPrecedence[best.Rule.Policy]
+	}
+
+	for _, g := range grants {
+		r := g.Rule
+		if r.Base() != check.Resource || len(r.Policy) < 1 {
+			continue
+		}
+		if r.Prefix() && !strings.HasPrefix(check.Segment, r.Segment) {
+			continue
+		}
+		if !r.Prefix() && r.Segment != check.Segment {
+			continue
+		}
+		if better(g) {
+			best = g
+		}
+	}
+	return best
+}
+
+// aclPolicyAllows reports whether a rule's policy grants the access
+func aclPolicyAllows(policy, access string) bool {
+	switch policy {
+	case "write":
+		return true
+	case "list":
+		return access == "read" || access == "list"
+	case "read":
+		return access == "read"
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseACLCheck(t *testing.T) {
+	cases := []struct {
+		spec    string
+		segment string
+		want    string
+		err     bool
+	}{
+		{spec: "key:write", segment: "app/config", want: `key:write app/config`},
+		{spec: "key:list", segment: "", want: `key:list`},
+		{spec: "operator:read", segment: "ignored", want: `operator:read`},
+		{spec: "service:read", segment: "web", want: `service:read web`},
+		{spec: "key", err: true},
+		{spec: "kv:read", segment: "app", err: true},
+		{spec: "key:deny", segment: "app", err: true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.spec, func(t *testing.T) {
+			check, err := parseACLCheck(tc.spec, tc.segment)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error, got %s", check)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got := check.String(); got != tc.want {
+				t.Errorf("check = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestMatchACLGrant(t *testing.T) {
+	grant := func(resource, segment, policy string) *aclGrant {
+		return &aclGrant{Rule: &aclRule{Resource: resource, Segment: segment, Policy: policy}, Source: "test"}
+	}
+
+	cases := []struct {
+		name   string
+		grants []*aclGrant
+		check  *aclCheck
+		want   int
+	}{
+		{
+			name:   "no match",
+			grants: []*aclGrant{grant("key", "other", "write")},
+			check:  &aclCheck{Resource: "key", Access: "read", Segment: "app"},
+			want:   -1,
+		},
+		{
+			name:   "other resource",
+			grants: []*aclGrant{grant("service_prefix", "", "write")},
+			check:  &aclCheck{Resource: "key", Access: "read", Segment: "app"},
+			want:   -1,
+		},
+		{
+			name:   "exact beats prefix",
+			grants: []*aclGrant{grant("key_prefix", "app/config", "deny"), grant("key", "app/config", "read")},
+			check:  &aclCheck{Resource: "key", Access: "read", Segment: "app/config"},
+			want:   1,
+		},
+		{
+			name:   "longest prefix wins",
+			grants: []*aclGrant{grant("key_prefix", "", "write"), grant("key_prefix", "app/", "deny"), grant("key_prefix", "app/con", "read")},
+			check:  &aclCheck{Resource: "key", Access: "read", Segment: "app/config"},
+			want:   2,
+		},
+		{
+			name:   "deny beats write",
+			grants: []*aclGrant{grant("key_prefix", "app/", "write"), grant("key_prefix", "app/", "deny")},
+			check:  &aclCheck{Resource: "key", Access: "read", Segment: "app/config"},
+			want:   1,
+		},
+		{
+			name:   "write beats list",
+			grants: []*aclGrant{grant("key", "app", "list"), grant("key", "app", "write")},
+			check:  &aclCheck{Resource: "key", Access: "write", Segment: "app"},
+			want:   1,
+		},
+		{
+			name:   "list beats read",
+			grants: []*aclGrant{grant("key", "app", "list"), grant("key", "app", "read")},
+			check:  &aclCheck{Resource: "key", Access: "list", Segment: "app"},
+			want:   0,
+		},
+		{
+			name:   "empty prefix matches the root",
+			grants: []*aclGrant{grant("key_prefix", "", "read")},
+			check:  &aclCheck{Resource: "key", Access: "read", Segment: ""},
+			want:   0,
+		},
+		{
+			name:   "rules without a policy are ignored",
+			grants: []*aclGrant{grant("service", "web", ""), grant("service_prefix", "", "read")},
+			check:  &aclCheck{Resource: "service", Access: "read", Segment: "web"},
+			want:   1,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := matchACLGrant(tc.grants, tc.check)
+			if tc.want < 0 {
+				if got != nil {
+					t.Fatalf("matched %s, want no match", got)
+				}
+				return
+			}
+			if got != tc.grants[tc.want] {
+				t.Errorf("matched %v, want %s", got, tc.grants[tc.want])
+			}
+		})
+	}
+}
+
+func TestACLPolicyAllows(t *testing.T) {
+	cases := []struct {
+		policy string
+		access string
+		want   bool
+	}{
+		{"write", "write", true},
+		{"write", "list", true},
+		{"write", "read", true},
+		{"list", "write", false},
+		{"list", "list", true},
+		{"list", "read", true},
+		{"read", "write", false},
+		{"read", "list", false},
+		{"read", "read", true},
+		{"deny", "read", false},
+		{"", "read", false},
+	}
+
+	for _, tc := range cases {
+		if got := aclPolicyAllows(tc.policy, tc.access); got != tc.want {
+			t.Errorf("aclPolicyAllows(%q, %q) = %v, want %v", tc.policy, tc.access, got, tc.want)
+		}
+	}
+}
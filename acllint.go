@@ -0,0 +1,325 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Resources that take a name or prefix, e.g. key_prefix "app/" { ... }
+var aclSegmentedResources = []string{"agent", "event", "key", "node", "query", "service", "session"}
+
+// Resources that take a single policy, e.g. operator = "read"
+var aclScalarResources = []string{"acl", "keyring", "mesh", "operator"}
+
+var aclPolicies = []string{"read", "write", "deny", "list"}
+
+// aclRule is a single resource rule parsed from HCL or JSON
+type aclRule struct {
+	Resource   string
+	Segment    string
+	Policy     string
+	Intentions string
+	Line       int
+}
+
+// Prefix is true for the _prefix form of a segmented resource
+func (r *aclRule) Prefix() bool {
+	return strings.HasSuffix(r.Resource, "_prefix")
+}
+
+// Base returns the resource without its _prefix suffix
+func (r *aclRule) Base() string {
+	return strings.TrimSuffix(r.Resource, "_prefix")
+}
+
+func (r *aclRule) String() string {
+	if stringArrayContains(r.Resource, aclScalarResources) {
+		return r.Resource
+	}
+	return fmt.Sprintf("%s %q", r.Resource, r.Segment)
+}
+
+// location is " (line N)", or empty for rules parsed from JSON which
+// carry no position
+func (r *aclRule) location() string {
+	if r.Line > 0 {
+		return fmt.Sprintf(" (line %d)", r.Line)
+	}
+	return ""
+}
+
+// aclLintFinding is an error or warning about a rule set
+type aclLintFinding struct {
+	Level   string
+	Line    int
+	Message string
+}
+
+func (f *aclLintFinding) String() string {
+	if f.Line > 0 {
+		return fmt.Sprintf("%s: line %d: %s", f.Level, f.Line, f.Message)
+	}
+	return fmt.Sprintf("%s: %s", f.Level, f.Message)
+}
+
+// parseACLRules parses HCL or JSON rules. Problems with individual
+// rules are returned as findings, only syntax errors are errors.
+func parseACLRules(src string) ([]*aclRule, []*aclLintFinding, error) {
+	file, err := hcl.ParseBytes([]byte(src))
+	if err != nil {
+		return nil, nil, err
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, nil, fmt.Errorf("rules must be an object")
+	}
+
+	rules := []*aclRule{}
+	findings := []*aclLintFinding{}
+	addError := func(line int, format string, args ...interface{}) {
+		findings = append(findings, &aclLintFinding{"error", line, fmt.Sprintf(format, args...)})
+	}
+
+	for _, item := range list.Items {
+		line := item.Pos().Line
+		keys := []string{}
+		for _, k := range item.Keys {
+			keys = append(keys, unquoteHCLKey(k.Token.Text))
+		}
+		resource := keys[0]
+
+		switch {
+		case stringArrayContains(resource, aclScalarResources):
+			lit, ok := item.Val.(*ast.LiteralType)
+			if len(keys) > 1 || !ok {
+				addError(line, "%s takes a single policy, e.g. %s = \"read\"", resource, resource)
+				continue
+			}
+			rules = append(rules, &aclRule{Resource: resource, Policy: literalString(lit), Line: line})
+
+		case stringArrayContains(strings.TrimSuffix(resource, "_prefix"), aclSegmentedResources):
+			obj, ok := item.Val.(*ast.ObjectType)
+			if len(keys) != 2 || !ok {
+				addError(line, "%s needs a name and a block, e.g. %s \"name\" { policy = \"read\" }", resource, resource)
+				continue
+			}
+			rule := &aclRule{Resource: resource, Segment: keys[1], Line: line}
+			for _, attr := range obj.List.Items {
+				name := unquoteHCLKey(attr.Keys[0].Token.Text)
+				lit, ok := attr.Val.(*ast.LiteralType)
+				if !ok {
+					addError(attr.Pos().Line, "%s in %s must be a string", name, rule)
+					continue
+				}
+				switch name {
+				case "policy":
+					rule.Policy = literalString(lit)
+				case "intentions":
+					rule.Intentions = literalString(lit)
+				default:
+					addError(attr.Pos().Line, "unknown attribute %s in %s", name, rule)
+				}
+			}
+			rules = append(rules, rule)
+
+		default:
+			addError(line, "unknown resource %s", resource)
+		}
+	}
+	return rules, findings, nil
+}
+
+func unquoteHCLKey(s string) string {
+	if u, err := strconv.Unquote(s); err == nil {
+		return u
+	}
+	return s
+}
+
+func literalString(lit *ast.LiteralType) string {
+	if s, ok := lit.Token.Value().(string); ok {
+		return s
+	}
+	return lit.Token.Text
+}
+
+// lintACLRules checks policy values and looks for duplicate
+// and overlapping rules on the same resource
+func lintACLRules(rules []*aclRule) []*aclLintFinding {
+	findings := []*aclLintFinding{}
+	add := func(level string, line int, format string, args ...interface{}) {
+		findings = append(findings, &aclLintFinding{level, line, fmt.Sprintf(format, args...)})
+	}
+
+	seen := map[string]*aclRule{}
+	for _, r := range rules {
+		switch {
+		case len(r.Policy) < 1 && len(r.Intentions) < 1:
+			add("error", r.Line, "%s has no policy", r)
+		case len(r.Policy) > 0 && !stringArrayContains(r.Policy, aclPolicies):
+			add("error", r.Line, "%s has invalid policy %q", r, r.Policy)
+		case r.Policy == "list" && r.Base() != "key":
+			add("error", r.Line, "%s can't use the list policy, it only applies to keys", r)
+		}
+		if len(r.Intentions) > 0 {
+			if r.Base() != "service" {
+				add("error", r.Line, "%s can't set intentions, only services can", r)
+			} else if r.Intentions == "list" || !stringArrayContains(r.Intentions, aclPolicies) {
+				add("error", r.Line, "%s has invalid intentions %q", r, r.Intentions)
+			}
+		}
+
+		if prev, ok := seen[r.String()]; ok {
+			add("warning", r.Line, "%s is already defined%s", r, prev.location())
+			continue
+		}
+		seen[r.String()] = r
+	}
+
+	// The longest matching prefix wins. An empty prefix is the usual way to
+	// set a default so it isn't reported, other overlaps are worth a look.
+	for _, a := range rules {
+		if !a.Prefix() || len(a.Segment) < 1 {
+			continue
+		}
+		for _, b := range rules {
+			if a == b || a.Resource != b.Resource || b.Segment == a.Segment || !strings.HasPrefix(b.Segment, a.Segment) {
+				continue
+			}
+			switch {
+			case a.Policy == b.Policy:
+				add("warning", b.Line, "%s is redundant, %s%s already grants %s", b, a, a.location(), a.Policy)
+			default:
+				add("warning", b.Line, "%s (%s) overrides %s (%s)%s", b, b.Policy, a, a.Policy, a.location())
+			}
+		}
+	}
+	return findings
+}
+
+// normalizeACLRules renders rules as sorted, consistently formatted HCL
+func normalizeACLRules(rules []*aclRule) string {
+	sorted := append([]*aclRule{}, rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Resource != sorted[j].Resource {
+			return sorted[i].Resource < sorted[j].Resource
+		}
+		return sorted[i].Segment < sorted[j].Segment
+	})
+
+	buf := &bytes.Buffer{}
+	for _, r := range sorted {
+		if stringArrayContains(r.Resource, aclScalarResources) {
+			fmt.Fprintf(buf, "%s = %q\n", r.Resource, r.Policy)
+			continue
+		}
+		fmt.Fprintf(buf, "%s %q {\n", r.Resource, r.Segment)
+		if len(r.Policy) > 0 {
+			fmt.Fprintf(buf, "  policy = %q\n", r.Policy)
+		}
+		if len(r.Intentions) > 0 {
+			fmt.Fprintf(buf, "  intentions = %q\n", r.Intentions)
+		}
+		fmt.Fprintf(buf, "}\n")
+	}
+	return buf.String()
+}
+
+// checkACLRules parses and lints rules, returning every finding. Only
+// findings with the error level should block a submission.
+func checkACLRules(src string) ([]*aclRule, []*aclLintFinding) {
+	rules, findings, err := parseACLRules(src)
+	if err != nil {
+		return nil, []*aclLintFinding{{Level: "error", Message: err.Error()}}
+	}
+	findings = append(findings, lintACLRules(rules)...)
+	sort.SliceStable(findings, func(i, j int) bool { return findings[i].Line < findings[j].Line })
+	return rules, findings
+}
+
+// aclRulesFromContext returns the rules from --rules-file if given,
+// otherwise from the named flag or the first argument
+func aclRulesFromContext(c *cli.Context, flag string) (string, bool, error) {
+	if path := c.String("rules-file"); len(path) > 0 {
+		var (
+			b   []byte
+			err error
+		)
+		if path == "-" {
+			b, err = ioutil.ReadAll(os.Stdin)
+		} else {
+			b, err = ioutil.ReadFile(path)
+		}
+		return string(b), true, err
+	}
+	if len(flag) > 0 {
+		return c.String(flag), c.IsSet(flag), nil
+	}
+	return c.Args().First(), c.Args().Present(), nil
+}
+
+// validateACLRules logs lint findings and returns false if the
+// rules have errors, unless --skip-lint was given
+func validateACLRules(c *cli.Context, src string) bool {
+	if c.Bool("skip-lint") || len(strings.TrimSpace(src)) < 1 {
+		return true
+	}
+	_, findings := checkACLRules(src)
+	ok := true
+	for _, f := range findings {
+		if f.Level == "error" {
+			log.Errorln(f)
+			ok = false
+			continue
+		}
+		log.Warnln(f)
+	}
+	if !ok {
+		log.Errorln("Rules have errors, fix them or use --skip-lint")
+	}
+	return ok
+}
+
+// LintACL checks rules files for CI. Exits non-zero on errors,
+// or on warnings too with --strict.
+func LintACL(c *cli.Context) {
+	if !c.Args().Present() {
+		log.Errorln("at least one rules file is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	failed := false
+	for _, path := range c.Args() {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Errorf("Could not load file: %v", err)
+			failed = true
+			continue
+		}
+
+		rules, findings := checkACLRules(string(b))
+		for _, f := range findings {
+			fmt.Printf("%s: %s\n", path, f)
+			if f.Level == "error" || c.Bool("strict") {
+				failed = true
+			}
+		}
+		if c.Bool("normalize") && rules != nil {
+			fmt.Print(normalizeACLRules(rules))
+		}
+	}
+
+	if failed {
+		log.Exit(1)
+	}
+}
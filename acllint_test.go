@@ -0,0 +1,244 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseACLRules(t *testing.T) {
+	cases := []struct {
+		name     string
+		src      string
+		rules    []aclRule
+		findings []string
+		err      bool
+	}{
+		{
+			name: "hcl",
+			src: `
+key_prefix "app/" {
+  policy = "read"
+}
+service "web" {
+  policy     = "write"
+  intentions = "read"
+}
+operator = "read"
+`,
+			rules: []aclRule{
+				{Resource: "key_prefix", Segment: "app/", Policy: "read", Line: 2},
+				{Resource: "service", Segment: "web", Policy: "write", Intentions: "read", Line: 5},
+				{Resource: "operator", Policy: "read", Line: 9},
+			},
+		},
+		{
+			name: "json",
+			src:  `{"key": {"app/db": {"policy": "write"}}, "keyring": "read"}`,
+			rules: []aclRule{
+				{Resource: "key", Segment: "app/db", Policy: "write"},
+				{Resource: "keyring", Policy: "read"},
+			},
+		},
+		{
+			name:     "unknown resource",
+			src:      `kv "app/" { policy = "read" }`,
+			rules:    []aclRule{},
+			findings: []string{"error: line 1: unknown resource kv"},
+		},
+		{
+			name:     "unknown attribute",
+			src:      `node "db1" { policy = "read" intention = "read" }`,
+			rules:    []aclRule{{Resource: "node", Segment: "db1", Policy: "read", Line: 1}},
+			findings: []string{`error: line 1: unknown attribute intention in node "db1"`},
+		},
+		{
+			name:     "scalar with a block",
+			src:      `operator "x" { policy = "read" }`,
+			rules:    []aclRule{},
+			findings: []string{`error: line 1: operator takes a single policy, e.g. operator = "read"`},
+		},
+		{
+			name:     "segmented without a name",
+			src:      `service = "read"`,
+			rules:    []aclRule{},
+			findings: []string{`error: line 1: service needs a name and a block, e.g. service "name" { policy = "read" }`},
+		},
+		{
+			name: "invalid hcl",
+			src:  `key "app/" {`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			rules, findings, err := parseACLRules(tc.src)
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := []aclRule{}
+			for _, r := range rules {
+				got = append(got, *r)
+			}
+			// JSON positions aren't reported consistently, only check HCL lines
+			if strings.HasPrefix(tc.src, "{") {
+				for i := range got {
+					got[i].Line = 0
+				}
+			}
+			if !reflect.DeepEqual(got, tc.rules) {
+				t.Errorf("rules = %+v, want %+v", got, tc.rules)
+			}
+			if msgs := findingStrings(findings); !reflect.DeepEqual(msgs, tc.findings) {
+				t.Errorf("findings = %q, want %q", msgs, tc.findings)
+			}
+		})
+	}
+}
+
+func TestLintACLRules(t *testing.T) {
+	cases := []struct {
+		name     string
+		rules    []*aclRule
+		findings []string
+	}{
+		{
+			name: "clean",
+			rules: []*aclRule{
+				{Resource: "key_prefix", Segment: "", Policy: "read", Line: 1},
+				{Resource: "key_prefix", Segment: "app/", Policy: "write", Line: 4},
+			},
+		},
+		{
+			name:     "no policy",
+			rules:    []*aclRule{{Resource: "node", Segment: "db1", Line: 1}},
+			findings: []string{`error: line 1: node "db1" has no policy`},
+		},
+		{
+			name:     "invalid policy",
+			rules:    []*aclRule{{Resource: "node", Segment: "db1", Policy: "admin", Line: 2}},
+			findings: []string{`error: line 2: node "db1" has invalid policy "admin"`},
+		},
+		{
+			name:     "list outside keys",
+			rules:    []*aclRule{{Resource: "service", Segment: "web", Policy: "list", Line: 3}},
+			findings: []string{`error: line 3: service "web" can't use the list policy, it only applies to keys`},
+		},
+		{
+			name:     "intentions outside services",
+			rules:    []*aclRule{{Resource: "node", Segment: "db1", Policy: "read", Intentions: "read", Line: 1}},
+			findings: []string{`error: line 1: node "db1" can't set intentions, only services can`},
+		},
+		{
+			name:     "invalid intentions",
+			rules:    []*aclRule{{Resource: "service", Segment: "web", Intentions: "list", Line: 1}},
+			findings: []string{`error: line 1: service "web" has invalid intentions "list"`},
+		},
+		{
+			name: "duplicate",
+			rules: []*aclRule{
+				{Resource: "key", Segment: "a", Policy: "read", Line: 1},
+				{Resource: "key", Segment: "a", Policy: "write", Line: 4},
+			},
+			findings: []string{`warning: line 4: key "a" is already defined (line 1)`},
+		},
+		{
+			name: "redundant prefix",
+			rules: []*aclRule{
+				{Resource: "key_prefix", Segment: "app/", Policy: "read", Line: 1},
+				{Resource: "key_prefix", Segment: "app/db/", Policy: "read", Line: 4},
+			},
+			findings: []string{`warning: line 4: key_prefix "app/db/" is redundant, key_prefix "app/" (line 1) already grants read`},
+		},
+		{
+			name: "overriding prefix",
+			rules: []*aclRule{
+				{Resource: "key_prefix", Segment: "app/", Policy: "read", Line: 1},
+				{Resource: "key_prefix", Segment: "app/db/", Policy: "deny", Line: 4},
+			},
+			findings: []string{`warning: line 4: key_prefix "app/db/" (deny) overrides key_prefix "app/" (read) (line 1)`},
+		},
+		{
+			name: "no line numbers from json",
+			rules: []*aclRule{
+				{Resource: "key", Segment: "a", Policy: "read"},
+				{Resource: "key", Segment: "a", Policy: "write"},
+				{Resource: "key_prefix", Segment: "app/", Policy: "read"},
+				{Resource: "key_prefix", Segment: "app/db/", Policy: "write"},
+			},
+			findings: []string{
+				`warning: key "a" is already defined`,
+				`warning: key_prefix "app/db/" (write) overrides key_prefix "app/" (read)`,
+			},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := findingStrings(lintACLRules(tc.rules)); !reflect.DeepEqual(got, tc.findings) {
+				t.Errorf("findings = %q, want %q", got, tc.findings)
+			}
+		})
+	}
+}
+
+func TestCheckACLRules(t *testing.T) {
+	cases := []struct {
+		name     string
+		src      string
+		findings []string
+	}{
+		{
+			name: "sorted by line",
+			src: `
+key "a" {
+  policy = "read"
+}
+key "a" {
+  policy = "bogus"
+}
+acl = "write"
+`,
+			findings: []string{
+				`error: line 5: key "a" has invalid policy "bogus"`,
+				`warning: line 5: key "a" is already defined (line 2)`,
+			},
+		},
+		{
+			name:     "parse error",
+			src:      `key "a" {`,
+			findings: []string{"error: "},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, findings := checkACLRules(tc.src)
+			got := findingStrings(findings)
+			if len(got) != len(tc.findings) {
+				t.Fatalf("findings = %q, want %q", got, tc.findings)
+			}
+			for i := range got {
+				if !strings.HasPrefix(got[i], tc.findings[i]) {
+					t.Errorf("finding %d = %q, want %q", i, got[i], tc.findings[i])
+				}
+			}
+		})
+	}
+}
+
+func findingStrings(findings []*aclLintFinding) []string {
+	var msgs []string
+	for _, f := range findings {
+		msgs = append(msgs, f.String())
+	}
+	return msgs
+}
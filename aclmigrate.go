@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Consul only accepts these characters in policy names
+var invalidPolicyNameChars = regexp.MustCompile(`[^A-Za-z0-9\-_]`)
+
+// legacyMigration is the planned upgrade of one legacy token
+type legacyMigration struct {
+	entry    *api.ACLEntry
+	accessor string
+	policy   string
+	rules    string
+	create   bool
+	problem  string
+}
+
+func BootstrapACL(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	t, _, err := cfg.client.ACL().Bootstrap()
+	if err != nil {
+		log.Fatalf("Could not bootstrap ACLs: %v", err)
+	}
+
+	if len(c.String("outfile")) < 1 {
+		printToken(c, t)
+		return
+	}
+
+	// The file is chmod'ed as well in case it already existed with looser permissions
+	f, err := os.OpenFile(c.String("outfile"), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err == nil {
+		err = f.Chmod(0600)
+		if err == nil {
+			_, err = fmt.Fprintln(f, t.SecretID)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		// Don't lose the only management token if the file can't be written
+		printToken(c, t)
+		log.Fatalf("Could not write token to %s: %v", c.String("outfile"), err)
+	}
+	log.Infof("Bootstrap token %s written to %s", t.AccessorID, c.String("outfile"))
+}
+
+func ACLReplicationStatus(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	dcs, err := cfg.client.Catalog().Datacenters()
+	if err != nil {
+		log.Fatalf("Could not list datacenters: %v", err)
+	}
+
+	statuses := map[string]*api.ACLReplicationStatus{}
+	failed := 0
+	for _, dc := range dcs {
+		opts := *cfg.queryOpts
+		opts.Datacenter = dc
+		status, _, err := cfg.client.ACL().Replication(&opts)
+		if err != nil {
+			log.Errorf("Could not get replication status for %s: %v", dc, err)
+			failed++
+			continue
+		}
+		statuses[dc] = status
+	}
+
+	// The datacenters that answered are still shown before failing
+	if c.GlobalBool("verbose") {
+		dumpJson(statuses)
+	} else {
+		prettyPrintReplicationStatus(dcs, statuses)
+	}
+	if failed > 0 {
+		log.Fatalf("Could not get replication status for %d of %d datacenters", failed, len(dcs))
+	}
+}
+
+func formatReplicationTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Format(time.RFC3339)
+}
+
+// MigrateLegacyACL upgrades every legacy token in place. Client tokens get a
+// policy holding their translated rules, tokens with identical rules share one,
+// and management tokens get global-management. Upgrading in place keeps the
+// secret, so nothing using the token has to change.
+func MigrateLegacyACL(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	acl := cfg.client.ACL()
+
+	entries, _, err := acl.List(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list legacy ACLs: %v", err)
+	}
+
+	// Legacy entries are keyed by secret, new tokens by accessor
+	tokens, _, err := acl.TokenList(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list tokens: %v", err)
+	}
+	accessors := map[string]string{}
+	for _, t := range tokens {
+		if !t.Legacy {
+			continue
+		}
+		full, _, err := acl.TokenRead(t.AccessorID, cfg.queryOpts)
+		if err != nil {
+			log.Warnf("Could not read token %s: %v", t.AccessorID, err)
+			continue
+		}
+		accessors[full.SecretID] = t.AccessorID
+	}
+
+	existing, _, err := acl.PolicyList(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list policies: %v", err)
+	}
+	policyNames := map[string]bool{}
+	for _, p := range existing {
+		policyNames[p.Name] = true
+	}
+
+	plan := []*legacyMigration{}
+	byRules := map[string]string{}
+	for _, e := range entries {
+		m := &legacyMigration{entry: e, accessor: accessors[e.ID]}
+		plan = append(plan, m)
+
+		if len(m.accessor) < 1 {
+			m.problem = "no matching token, already migrated or not readable"
+			continue
+		}
+		if e.Type == api.ACLManagementType {
+			m.policy = "global-management"
+			continue
+		}
+
+		rules, err := acl.RulesTranslateToken(m.accessor)
+		if err != nil {
+			m.problem = fmt.Sprintf("could not translate rules: %v", err)
+			continue
+		}
+		rules = strings.TrimSpace(rules)
+		if name, ok := byRules[rules]; ok {
+			m.policy = name
+			continue
+		}
+
+		m.policy = legacyPolicyName(e.Name, m.accessor, policyNames)
+		m.rules = rules
+		m.create = true
+		policyNames[m.policy] = true
+		byRules[rules] = m.policy
+	}
+
+	sort.Slice(plan, func(i, j int) bool { return plan[i].entry.Name < plan[j].entry.Name })
+
+	w := getTabwriter()
+	fmt.Fprintf(w, "Name\tAccessorID\tType\tPolicy\tAction\n")
+	for _, m := range plan {
+		action := "upgrade"
+		if m.create {
+			action = "create policy, upgrade"
+		}
+		if len(m.problem) > 0 {
+			action = "skip: " + m.problem
+		}
+		// The legacy ID is the secret, never show any of it
+		accessor := m.accessor
+		if len(accessor) < 1 {
+			accessor = "-"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.entry.Name, accessor, m.entry.Type, m.policy, action)
+	}
+	w.Flush()
+
+	if c.Bool("dry-run") {
+		return
+	}
+
+	// Tokens sharing a policy can't be upgraded if creating it failed
+	failed := 0
+	failedPolicies := map[string]bool{}
+	for _, m := range plan {
+		if len(m.problem) > 0 {
+			continue
+		}
+		if failedPolicies[m.policy] {
+			log.Errorf("Skipping token %s, its policy %s could not be created", m.accessor, m.policy)
+			failed++
+			continue
+		}
+		if m.create {
+			_, _, err := acl.PolicyCreate(&api.ACLPolicy{
+				Name:        m.policy,
+				Description: fmt.Sprintf("Migrated from legacy ACL %q", m.entry.Name),
+				Rules:       m.rules,
+			}, cfg.writeOpts)
+			if err != nil {
+				log.Errorf("Could not create policy %s: %v", m.policy, err)
+				failedPolicies[m.policy] = true
+				failed++
+				continue
+			}
+		}
+
+		t, _, err := acl.TokenRead(m.accessor, cfg.queryOpts)
+		if err != nil {
+			log.Errorf("Could not read token %s: %v", m.accessor, err)
+			failed++
+			continue
+		}
+		t.Rules = ""
+		t.Policies = append(t.Policies, &api.ACLLink{Name: m.policy})
+		if len(t.Description) < 1 {
+			t.Description = m.entry.Name
+		}
+		if _, _, err = acl.TokenUpdate(t, cfg.writeOpts); err != nil {
+			log.Errorf("Could not upgrade token %s: %v", m.accessor, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d legacy tokens could not be migrated", failed)
+	}
+	log.Println("Success")
+}
+
+// legacyPolicyName builds a unique, valid policy name from the legacy
+// ACL's name, or its accessor ID if it has none. The legacy ID is the
+// token's secret so it must never end up in a name.
+func legacyPolicyName(name, accessor string, taken map[string]bool) string {
+	if len(name) < 1 {
+		name = accessor
+	}
+	base := "legacy-" + strings.ToLower(invalidPolicyNameChars.ReplaceAllString(name, "-"))
+	if len(base) > 120 {
+		// Leave room for the suffix that makes it unique
+		base = base[:120]
+	}
+	policy := base
+	for i := 2; taken[policy]; i++ {
+		policy = fmt.Sprintf("%s-%d", base, i)
+	}
+	return policy
+}
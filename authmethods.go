@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+)
+
+func CreateAuthMethod(c *cli.Context) {
+	if len(c.String("name")) < 1 || len(c.String("type")) < 1 {
+		log.Errorln("--name and --type are required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	method := &api.ACLAuthMethod{}
+	if err := applyAuthMethodFlags(c, method); err != nil {
+		log.Errorf("Invalid auth method: %v", err)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	m, _, err := cfg.client.ACL().AuthMethodCreate(method, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create auth method: %v", err)
+	}
+	printAuthMethod(c, m)
+}
+
+func ReadAuthMethod(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("auth method name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	m, err := readAuthMethod(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read auth method: %v", err)
+	}
+	printAuthMethod(c, m)
+}
+
+func UpdateAuthMethod(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("auth method name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	method, err := readAuthMethod(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read auth method: %v", err)
+	}
+	if err = applyAuthMethodFlags(c, method); err != nil {
+		log.Fatalf("Invalid auth method: %v", err)
+	}
+
+	m, _, err := cfg.client.ACL().AuthMethodUpdate(method, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not update auth method: %v", err)
+	}
+	printAuthMethod(c, m)
+}
+
+func DeleteAuthMethod(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("auth method name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	if _, err = cfg.client.ACL().AuthMethodDelete(c.Args().First(), cfg.writeOpts); err != nil {
+		log.Fatalf("Could not delete auth method: %v", err)
+	}
+	log.Println("Success")
+}
+
+func ListAuthMethods(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	methods, _, err := cfg.client.ACL().AuthMethodList(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list auth methods: %v", err)
+	}
+
+	if useJsonOutput(c) {
+		dumpJson(methods)
+		return
+	}
+	prettyPrintAuthMethodList(methods)
+}
+
+func readAuthMethod(cfg *AppConfig, name string) (*api.ACLAuthMethod, error) {
+	m, _, err := cfg.client.ACL().AuthMethodRead(name, cfg.queryOpts)
+	if err == nil && m == nil {
+		err = fmt.Errorf("auth method %s not found", name)
+	}
+	return m, err
+}
+
+// applyAuthMethodFlags copies the flags that were set onto the auth method
+func applyAuthMethodFlags(c *cli.Context, method *api.ACLAuthMethod) error {
+	if c.IsSet("name") {
+		method.Name = c.String("name")
+	}
+	if c.IsSet("type") {
+		method.Type = c.String("type")
+	}
+	if c.IsSet("display-name") {
+		method.DisplayName = c.String("display-name")
+	}
+	if c.IsSet("description") {
+		method.Description = c.String("description")
+	}
+	if c.IsSet("max-token-ttl") {
+		method.MaxTokenTTL = c.Duration("max-token-ttl")
+	}
+	if c.IsSet("token-locality") {
+		method.TokenLocality = c.String("token-locality")
+	}
+
+	raw := []byte(c.String("config"))
+	if path := c.String("config-file"); len(path) > 0 {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		raw = b
+	}
+	if len(raw) > 0 {
+		config := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &config); err != nil {
+			return fmt.Errorf("config must be a JSON object: %v", err)
+		}
+		method.Config = config
+	}
+	return nil
+}
+
+func printAuthMethod(c *cli.Context, m *api.ACLAuthMethod) {
+	if useJsonOutput(c) {
+		dumpJson(m)
+		return
+	}
+	prettyPrintAuthMethod(m)
+}
+
+func CreateBindingRule(c *cli.Context) {
+	if len(c.String("method")) < 1 || len(c.String("bind-type")) < 1 || len(c.String("bind-name")) < 1 {
+		log.Errorln("--method, --bind-type and --bind-name are required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	rule := &api.ACLBindingRule{}
+	if err := applyBindingRuleFlags(c, rule); err != nil {
+		log.Errorf("Invalid binding rule: %v", err)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	r, _, err := cfg.client.ACL().BindingRuleCreate(rule, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create binding rule: %v", err)
+	}
+	printBindingRule(c, r)
+}
+
+func ReadBindingRule(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("binding rule ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	r, err := readBindingRule(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read binding rule: %v", err)
+	}
+	printBindingRule(c, r)
+}
+
+func UpdateBindingRule(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("binding rule ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	rule, err := readBindingRule(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read binding rule: %v", err)
+	}
+	if err = applyBindingRuleFlags(c, rule); err != nil {
+		log.Fatalf("Invalid binding rule: %v", err)
+	}
+
+	r, _, err := cfg.client.ACL().BindingRuleUpdate(rule, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not update binding rule: %v", err)
+	}
+	printBindingRule(c, r)
+}
+
+func DeleteBindingRule(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("binding rule ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	if _, err = cfg.client.ACL().BindingRuleDelete(c.Args().First(), cfg.writeOpts); err != nil {
+		log.Fatalf("Could not delete binding rule: %v", err)
+	}
+	log.Println("Success")
+}
+
+func ListBindingRules(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	rules, _, err := cfg.client.ACL().BindingRuleList(c.String("method"), cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list binding rules: %v", err)
+	}
+
+	if useJsonOutput(c) {
+		dumpJson(rules)
+		return
+	}
+	prettyPrintBindingRuleList(rules)
+}
+
+func readBindingRule(cfg *AppConfig, id string) (*api.ACLBindingRule, error) {
+	r, _, err := cfg.client.ACL().BindingRuleRead(id, cfg.queryOpts)
+	if err == nil && r == nil {
+		err = fmt.Errorf("binding rule %s not found", id)
+	}
+	return r, err
+}
+
+// applyBindingRuleFlags copies the flags that were set onto the binding rule
+func applyBindingRuleFlags(c *cli.Context, rule *api.ACLBindingRule) error {
+	if c.IsSet("method") {
+		rule.AuthMethod = c.String("method")
+	}
+	if c.IsSet("description") {
+		rule.Description = c.String("description")
+	}
+	if c.IsSet("selector") {
+		rule.Selector = c.String("selector")
+	}
+	if c.IsSet("bind-type") {
+		switch t := api.BindingRuleBindType(c.String("bind-type")); t {
+		case api.BindingRuleBindTypeService, api.BindingRuleBindTypeRole, api.BindingRuleBindType("node"):
+			rule.BindType = t
+		default:
+			return fmt.Errorf("bind type must be service, node or role, not %s", t)
+		}
+	}
+	if c.IsSet("bind-name") {
+		rule.BindName = c.String("bind-name")
+	}
+	return nil
+}
+
+func printBindingRule(c *cli.Context, r *api.ACLBindingRule) {
+	if useJsonOutput(c) {
+		dumpJson(r)
+		return
+	}
+	prettyPrintBindingRule(r)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"strings"
+)
+
+func CatalogRegister(c *cli.Context) {
+	if len(c.Args().First()) < 1 || len(c.String("address")) < 1 {
+		log.Errorln("node name and --address are required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	nodeMeta, err := parseKeyValues(c.StringSlice("node-meta"))
+	if err != nil {
+		log.Errorf("Invalid node meta: %v", err)
+		log.Exit(2)
+	}
+	taggedAddrs, err := parseKeyValues(c.StringSlice("tagged-address"))
+	if err != nil {
+		log.Errorf("Invalid tagged address: %v", err)
+		log.Exit(2)
+	}
+
+	// Mark the node the same way consul-esm does so it
+	// picks up health checking for external services
+	if c.Bool("external") {
+		if nodeMeta == nil {
+			nodeMeta = map[string]string{}
+		}
+		nodeMeta["external-node"] = "true"
+		nodeMeta["external-probe"] = "true"
+	}
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	reg := &api.CatalogRegistration{
+		Node:            c.Args().First(),
+		Address:         c.String("address"),
+		NodeMeta:        nodeMeta,
+		TaggedAddresses: taggedAddrs,
+		Datacenter:      c.GlobalString("datacenter"),
+		SkipNodeUpdate:  c.Bool("skip-node-update"),
+	}
+
+	if len(c.String("service")) > 0 {
+		reg.Service = &api.AgentService{
+			ID:      c.String("service-id"),
+			Service: c.String("service"),
+			Address: c.String("service-address"),
+			Port:    c.Int("port"),
+		}
+		if len(reg.Service.ID) < 1 {
+			reg.Service.ID = reg.Service.Service
+		}
+		if len(c.String("tags")) > 0 {
+			reg.Service.Tags = strings.Split(c.String("tags"), ",")
+		}
+	}
+
+	if len(c.String("check")) > 0 {
+		reg.Check = &api.AgentCheck{
+			Node:    reg.Node,
+			CheckID: c.String("check-id"),
+			Name:    c.String("check"),
+			Status:  c.String("check-status"),
+			Notes:   c.String("check-notes"),
+		}
+		if len(reg.Check.CheckID) < 1 {
+			reg.Check.CheckID = reg.Check.Name
+		}
+		if reg.Service != nil {
+			reg.Check.ServiceID = reg.Service.ID
+		}
+	}
+
+	if _, err = cfg.client.Catalog().Register(reg, cfg.writeOpts); err != nil {
+		log.Fatalf("Error registering catalog entry: %v", err)
+	}
+	log.Println("Success")
+}
+
+func CatalogDeregister(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("node name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	// With neither --service-id nor --check-id the whole node is removed
+	dereg := &api.CatalogDeregistration{
+		Node:       c.Args().First(),
+		Datacenter: c.GlobalString("datacenter"),
+		ServiceID:  c.String("service-id"),
+		CheckID:    c.String("check-id"),
+	}
+
+	if _, err = cfg.client.Catalog().Deregister(dereg, cfg.writeOpts); err != nil {
+		log.Fatalf("Error deregistering catalog entry: %v", err)
+	}
+	log.Println("Success")
+}
@@ -1,9 +1,14 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/codegangsta/cli"
 	"github.com/hashicorp/consul/api"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"strings"
+	"time"
 )
 
 func UpdateCheck(c *cli.Context) {
@@ -24,34 +29,104 @@ func UpdateCheck(c *cli.Context) {
 }
 
 func RegisterCheck(c *cli.Context) {
-	// Get client
-	cfg, err := NewAppConfig(c)
+	acr := &api.AgentCheckRegistration{}
+
+	// Load the definition file first so flags can override it
+	if len(c.String("file")) > 0 {
+		fileBytes, err := ioutil.ReadFile(c.String("file"))
+		if err != nil {
+			log.Errorf("Could not load file: %v", err)
+			log.Exit(2)
+		}
+		if err = loadCheckDefinition(fileBytes, acr); err != nil {
+			log.Errorf("Could not parse check definition: %v", err)
+			log.Exit(2)
+		}
+	}
+
+	header, err := parseCheckHeaders(c.StringSlice("header"))
 	if err != nil {
-		log.Errorf("Failed to get client: %v", err)
-		return
+		log.Errorf("Invalid header: %v", err)
+		log.Exit(2)
+	}
+
+	setString := func(dst *string, flag string) {
+		if len(c.String(flag)) > 0 {
+			*dst = c.String(flag)
+		}
+	}
+
+	if c.Args().Present() {
+		acr.Name = c.Args().First()
+	}
+	setString(&acr.ID, "id")
+	setString(&acr.ServiceID, "service")
+	setString(&acr.Notes, "notes")
+	setString(&acr.Status, "status")
+	setString(&acr.HTTP, "http")
+	setString(&acr.Method, "method")
+	setString(&acr.Body, "body")
+	setString(&acr.TCP, "tcp")
+	setString(&acr.GRPC, "grpc")
+	setString(&acr.DockerContainerID, "docker-container-id")
+	setString(&acr.Shell, "shell")
+	setString(&acr.Interval, "interval")
+	setString(&acr.TTL, "ttl")
+	setString(&acr.Timeout, "timeout")
+	setString(&acr.TLSServerName, "tls-server-name")
+	setString(&acr.DeregisterCriticalServiceAfter, "deregister-after")
+
+	if len(c.StringSlice("args")) > 0 {
+		acr.Args = c.StringSlice("args")
+	} else if len(c.String("script")) > 0 {
+		// Script was removed from Consul, run it through a shell instead
+		acr.Args = []string{"/bin/sh", "-c", c.String("script")}
+	}
+	if header != nil {
+		acr.Header = header
+	}
+	if c.Bool("grpc-tls") {
+		acr.GRPCUseTLS = true
+	}
+	if c.Bool("tls-skip-verify") {
+		acr.TLSSkipVerify = true
 	}
 
-	asc := api.AgentServiceCheck{
-		Script:   c.String("script"),
-		HTTP:     c.String("http"),
-		TCP:      c.String("tcp"),
-		Interval: c.String("interval"),
-		TTL:      c.String("ttl"),
-		Timeout:  c.String("timeout"),
+	if len(acr.Name) < 1 {
+		log.Errorln("check name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
 	}
 
-	acr := &api.AgentCheckRegistration{AgentServiceCheck: asc}
-	acr.ServiceID = c.String("service")
-	acr.Notes = c.String("notes")
-	acr.Name = c.Args().First()
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
 
 	if err = cfg.client.Agent().CheckRegister(acr); err != nil {
-		log.Printf("Error registering check: %v", err)
-		return
+		log.Fatalf("Error registering check: %v", err)
 	}
 	log.Println("Success")
 }
 
+// parseCheckHeaders turns curl style "Name: value" strings into an HTTP check header map
+func parseCheckHeaders(headers []string) (map[string][]string, error) {
+	if len(headers) < 1 {
+		return nil, nil
+	}
+	results := map[string][]string{}
+	for _, h := range headers {
+		split := strings.SplitN(h, ":", 2)
+		if len(split) < 2 || len(strings.TrimSpace(split[0])) < 1 {
+			return nil, fmt.Errorf("expected 'Name: value', got %q", h)
+		}
+		name := strings.TrimSpace(split[0])
+		results[name] = append(results[name], strings.TrimSpace(split[1]))
+	}
+	return results, nil
+}
+
 func DeregisterCheck(c *cli.Context) {
 	// Get client
 	cfg, err := NewAppConfig(c)
@@ -81,6 +156,16 @@ func ListChecks(c *cli.Context) {
 		return
 	}
 
+	for id, ch := range checks {
+		if len(c.String("status")) > 0 && ch.Status != c.String("status") {
+			delete(checks, id)
+			continue
+		}
+		if len(c.String("service")) > 0 && ch.ServiceID != c.String("service") && ch.ServiceName != c.String("service") {
+			delete(checks, id)
+		}
+	}
+
 	if c.GlobalBool("verbose") {
 		dumpJson(checks)
 		return
@@ -88,3 +173,107 @@ func ListChecks(c *cli.Context) {
 
 	prettyPrintChecks(checks)
 }
+
+// checkTransition is a status change seen while watching a check
+type checkTransition struct {
+	Time     time.Time
+	Previous string
+	Status   string
+	Output   string
+}
+
+func GetCheck(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("check ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+	id := c.Args().First()
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	checks, err := cfg.client.Agent().Checks()
+	if err != nil {
+		log.Fatalf("Error listing checks: %v", err)
+	}
+	check, ok := checks[id]
+	if !ok {
+		log.Fatalf("Check %s is not registered with this agent", id)
+	}
+
+	if c.GlobalBool("verbose") {
+		dumpJson(check)
+	} else {
+		prettyPrintCheck(check)
+	}
+
+	if !c.Bool("watch") {
+		return
+	}
+
+	// The agent endpoint doesn't block, so watch this node's
+	// checks in the catalog and pick ours out of the results
+	history := []*checkTransition{}
+	keep := c.Int("history")
+	if keep < 1 {
+		keep = 1
+	}
+	status := check.Status
+	var index uint64
+	for {
+		nodeChecks, meta, err := cfg.client.Health().Node(check.Node,
+			blockingQueryOpts(cfg.queryOpts, index, 5*time.Minute))
+		if err != nil {
+			log.Errorf("Failed to watch check: %v", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		if meta.LastIndex < index {
+			index = 0
+			continue
+		}
+		index = meta.LastIndex
+
+		for _, hc := range nodeChecks {
+			if hc.CheckID != id || hc.Status == status {
+				continue
+			}
+			history = append(history, &checkTransition{
+				Time:     time.Now(),
+				Previous: status,
+				Status:   hc.Status,
+				Output:   hc.Output,
+			})
+			if len(history) > keep {
+				history = history[len(history)-keep:]
+			}
+			status = hc.Status
+
+			if c.GlobalBool("verbose") {
+				dumpJson(history[len(history)-1])
+				continue
+			}
+			prettyPrintCheckHistory(history)
+		}
+	}
+}
+
+// loadCheckDefinition accepts {"check": {...}} as well as a bare check
+// definition, with Consul's snake_case keys or api field names
+func loadCheckDefinition(data []byte, acr *api.AgentCheckRegistration) error {
+	def := map[string]interface{}{}
+	if err := json.Unmarshal(data, &def); err != nil {
+		return err
+	}
+	var v interface{} = def
+	if check, ok := def["check"]; ok && len(def) == 1 {
+		v = check
+	} else if check, ok := def["Check"]; ok && len(def) == 1 {
+		v = check
+	}
+	return decodeConsulDefinition(v, acr)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"github.com/codegangsta/cli"
+	"time"
 )
 
 var (
@@ -53,6 +54,11 @@ var (
 			Usage:  "(Optional) Consul ACL Token",
 			EnvVar: "CONSULCTL_TOKEN",
 		},
+		cli.StringFlag{
+			Name:   "token-cache",
+			Usage:  "(Optional) File holding tokens from login, defaults to ~/.consulctl/tokens.json",
+			EnvVar: "CONSULCTL_TOKEN_CACHE",
+		},
 		cli.BoolFlag{
 			Name:   "verbose,j",
 			Usage:  "Use verbose output (usually means JSON)",
@@ -129,19 +135,87 @@ var (
 		ArgsUsage: " ",
 		Subcommands: []cli.Command{
 			cli.Command{
-				Name:      "list",
-				Aliases:   []string{"ls"},
-				Usage:     "List recent events",
+				Name:        "list",
+				Aliases:     []string{"ls"},
+				Usage:       "List recent events",
+				Description: "Consul doesn't record when events were fired, so PayloadAge is only shown for JSON payloads with an RFC 3339 time or timestamp field, like those from event fire --template using .Time",
+				ArgsUsage:   "optional-name",
+				Action:      ListEvents,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "name",
+						Usage: "Only list events with this name",
+					},
+					cli.StringFlag{
+						Name:  "node-filter",
+						Usage: "Only list events whose node filter matches this regex",
+					},
+					cli.Int64Flag{
+						Name:  "since",
+						Usage: "Only list events with a higher LTime than this",
+					},
+					cli.IntFlag{
+						Name:  "last",
+						Usage: "Only list the N most recent events",
+					},
+					cli.StringFlag{
+						Name:  "payload-format",
+						Usage: "How to show payloads (text, json, base64 or hex)",
+						Value: "text",
+					},
+				},
+			},
+			cli.Command{
+				Name:      "watch",
+				Usage:     "Stream new events as they arrive",
 				ArgsUsage: "optional-name",
-				Action:    ListEvents,
+				Action:    WatchEvents,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "handler,e",
+						Usage: "Command to run for each event, the payload is passed on stdin and metadata in CONSUL_EVENT_* variables",
+					},
+					cli.BoolFlag{
+						Name:  "replay",
+						Usage: "Also handle the events the agent already has",
+					},
+					cli.DurationFlag{
+						Name:  "wait,w",
+						Usage: "Maximum blocking query wait time",
+						Value: 5 * time.Minute,
+					},
+					cli.DurationFlag{
+						Name:  "retry",
+						Usage: "Delay before retrying a failed query",
+						Value: 5 * time.Second,
+					},
+				},
 			},
 			cli.Command{
 				Name:      "fire",
 				Aliases:   []string{"new"},
 				Usage:     "Fire a new event",
-				ArgsUsage: "name payload",
+				ArgsUsage: "name payload|@file|-",
 				Action:    FireEvent,
 				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "template",
+						Usage: "Render the payload from a JSON template, with .Datacenter, .Name, .Time and .Vars",
+					},
+					cli.StringSliceFlag{
+						Name:  "var",
+						Usage: "key=value available to the template as .Vars.key (may be repeated)",
+						Value: &cli.StringSlice{},
+					},
+					cli.BoolFlag{
+						Name:  "all-datacenters",
+						Usage: "Fire the event in every datacenter",
+					},
+					cli.IntFlag{
+						Name:  "max-size",
+						Usage: "Largest event in bytes, including Consul's encoding overhead",
+						Value: 512,
+					},
 					cli.StringFlag{
 						Name:  "node,n",
 						Usage: "Node filter regex",
@@ -237,144 +311,1273 @@ var (
 				ArgsUsage: "[enable|disable] service 'Optional reason string'",
 				Action:    ServiceMaint,
 			},
-		},
-	}
-
-	ACLCommand = cli.Command{
-		Name:      "acl",
-		Usage:     "Manipulate the ACL catalog",
-		ArgsUsage: " ",
-		Subcommands: []cli.Command{
 			{
-				Name:      "register",
-				Aliases:   []string{"new"},
-				Usage:     "Create an ACL token",
-				ArgsUsage: "'{\"rule\":\"json\"}'",
-				Action:    CreateACL,
+				Name:      "watch",
+				Usage:     "Stream health changes for a service",
+				ArgsUsage: "service-name",
+				Action:    WatchService,
 				Flags: []cli.Flag{
 					cli.StringFlag{
-						Name:  "type,t",
-						Usage: "ACL Token type (client or management)",
+						Name:  "tag,t",
+						Usage: "Only watch instances with this tag",
+					},
+					cli.BoolFlag{
+						Name:  "passing",
+						Usage: "Only track passing instances",
 					},
 					cli.StringFlag{
-						Name:  "name,n",
-						Usage: "ACL name",
+						Name:  "format,f",
+						Usage: "Output format (table or json)",
+						Value: "table",
 					},
 					cli.StringFlag{
-						Name:  "id,i",
-						Usage: "ID of ACL",
+						Name:  "exec,e",
+						Usage: "Command to run on each change, the changes are passed as JSON on stdin",
+					},
+					cli.DurationFlag{
+						Name:  "wait,w",
+						Usage: "Maximum blocking query wait time",
+						Value: 5 * time.Minute,
+					},
+					cli.DurationFlag{
+						Name:  "retry",
+						Usage: "Delay before retrying a failed query",
+						Value: 5 * time.Second,
 					},
 				},
 			},
 			{
-				Name:      "deregister",
-				Aliases:   []string{"rm"},
-				Usage:     "Remove an ACL token",
-				ArgsUsage: "service-id",
-				Action:    DeregisterACL,
-			},
-			{
-				Name:      "list",
-				Aliases:   []string{"ls"},
-				Usage:     "List ACL tokens",
-				ArgsUsage: " ",
-				Action:    ListACL,
+				Name:      "resolve",
+				Usage:     "Look up healthy instances of a service",
+				ArgsUsage: "service-name[.tag]",
+				Action:    ResolveService,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format,f",
+						Usage: "Output format (addr, a, srv, url or json)",
+						Value: "addr",
+					},
+					cli.StringFlag{
+						Name:  "order,o",
+						Usage: "Result order (sorted, random or nearest)",
+						Value: "sorted",
+					},
+					cli.StringFlag{
+						Name:  "near",
+						Usage: "Node to measure distance from when ordering by nearest",
+						Value: "_agent",
+					},
+					cli.StringFlag{
+						Name:  "scheme,s",
+						Usage: "URL scheme for the url format",
+						Value: "http",
+					},
+					cli.BoolFlag{
+						Name:  "one,1",
+						Usage: "Only print the first instance",
+					},
+				},
 			},
 			{
-				Name:      "clone",
-				Usage:     "Clone a token into a new entry",
-				ArgsUsage: " ",
-				Action:    CloneACL,
+				Name:      "export",
+				Usage:     "Generate load balancer configs from healthy instances",
+				ArgsUsage: "[service-name...]",
+				Action:    ExportServices,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "format,f",
+						Usage: "Output format (haproxy, nginx, envoy-eds or prometheus-sd)",
+						Value: "haproxy",
+					},
+					cli.StringFlag{
+						Name:  "tag,t",
+						Usage: "Only export instances with this tag",
+					},
+					cli.StringFlag{
+						Name:  "outfile,o",
+						Usage: "Write output to a file",
+					},
+					cli.BoolFlag{
+						Name:  "watch,w",
+						Usage: "Keep running and rewrite the file when instances change",
+					},
+					cli.StringFlag{
+						Name:  "reload,r",
+						Usage: "Command to run after the file is rewritten",
+					},
+					cli.DurationFlag{
+						Name:  "wait",
+						Usage: "Maximum blocking query wait time",
+						Value: time.Minute,
+					},
+					cli.DurationFlag{
+						Name:  "retry",
+						Usage: "Delay before retrying a failed query",
+						Value: 5 * time.Second,
+					},
+				},
 			},
 			{
-				Name:      "update",
-				Aliases:   []string{"up"},
-				Usage:     "Update an ACL token",
-				ArgsUsage: "'{\"rule\":\"json\"}'",
+				Name:      "drain",
+				Usage:     "Put a service in maintenance mode and wait for traffic to stop",
+				ArgsUsage: "service-id",
+				Action:    DrainService,
 				Flags: []cli.Flag{
 					cli.StringFlag{
-						Name:  "type,t",
-						Usage: "ACL Token type (client or management)",
+						Name:  "reason,r",
+						Usage: "Maintenance mode reason",
+						Value: "Draining with consulctl",
 					},
-					cli.StringFlag{
-						Name:  "name,n",
-						Usage: "ACL name",
+					cli.DurationFlag{
+						Name:  "delay,d",
+						Usage: "Time to wait for connections to drain",
+						Value: 30 * time.Second,
 					},
 					cli.StringFlag{
-						Name:  "id,i",
-						Usage: "ID of ACL (required)",
+						Name:  "until,u",
+						Usage: "Command that exits 0 once the service is drained, replaces --delay",
+					},
+					cli.DurationFlag{
+						Name:  "interval,i",
+						Usage: "How often to run the --until command",
+						Value: 5 * time.Second,
+					},
+					cli.DurationFlag{
+						Name:  "timeout,t",
+						Usage: "Give up on the --until command after this long",
+						Value: 5 * time.Minute,
+					},
+					cli.BoolFlag{
+						Name:  "deregister",
+						Usage: "Deregister the service once drained",
 					},
 				},
-				Action: UpdateACL,
+			},
+			{
+				Name:      "sync",
+				Usage:     "Make the agent's services match a directory of definitions",
+				ArgsUsage: "definition-dir",
+				Action:    SyncServices,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "dry-run,n",
+						Usage: "Only show the plan",
+					},
+					cli.StringSliceFlag{
+						Name:  "keep,k",
+						Usage: "Never deregister service IDs matching this glob (may be repeated)",
+						Value: &cli.StringSlice{},
+					},
+				},
+			},
+			{
+				Name:      "diff",
+				Usage:     "Compare the agent's services and checks with the catalog",
+				ArgsUsage: " ",
+				Action:    DiffServices,
 			},
 		},
 	}
 
-	CheckCommand = cli.Command{
-		Name:      "check",
-		Usage:     "Manipulate the health check catalog",
+	CatalogCommand = cli.Command{
+		Name:      "catalog",
+		Usage:     "Manipulate external nodes in the catalog",
 		ArgsUsage: " ",
 		Subcommands: []cli.Command{
 			{
 				Name:      "register",
 				Aliases:   []string{"new"},
-				Usage:     "Create or edit a check",
-				ArgsUsage: "checkname",
-				Action:    RegisterCheck,
+				Usage:     "Register an external node, service or check",
+				ArgsUsage: "node-name",
+				Action:    CatalogRegister,
 				Flags: []cli.Flag{
 					cli.StringFlag{
-						Name:  "http,h",
-						Usage: "HTTP check endpoint",
+						Name:  "address,a",
+						Usage: "Node address (required)",
+					},
+					cli.StringSliceFlag{
+						Name:  "node-meta,m",
+						Usage: "Node metadata as key=value (may be repeated)",
+						Value: &cli.StringSlice{},
+					},
+					cli.StringSliceFlag{
+						Name:  "tagged-address",
+						Usage: "Tagged address as tag=address (may be repeated)",
+						Value: &cli.StringSlice{},
+					},
+					cli.BoolFlag{
+						Name:  "external,e",
+						Usage: "Add the external-node and external-probe meta used by consul-esm",
+					},
+					cli.BoolFlag{
+						Name:  "skip-node-update",
+						Usage: "Don't overwrite an existing node's address and meta",
 					},
 					cli.StringFlag{
-						Name:  "tcp,t",
-						Usage: "TCP check endpoint",
+						Name:  "service,s",
+						Usage: "Service name",
 					},
 					cli.StringFlag{
-						Name:  "interval,i",
-						Usage: "Check interval",
+						Name:  "service-id",
+						Usage: "Service ID (defaults to the service name)",
 					},
 					cli.StringFlag{
-						Name:  "script,x",
-						Usage: "Check script path",
+						Name:  "service-address",
+						Usage: "Service address if different from the node",
+					},
+					cli.IntFlag{
+						Name:  "port,p",
+						Usage: "Service port",
 					},
 					cli.StringFlag{
-						Name:  "ttl,l",
-						Usage: "Check TTL",
+						Name:  "tags,t",
+						Usage: "Comma separated service tags",
 					},
 					cli.StringFlag{
-						Name:  "service,s",
-						Usage: "Service ID to associate with this check",
+						Name:  "check,c",
+						Usage: "Check name",
 					},
 					cli.StringFlag{
-						Name:  "notes,n",
-						Usage: "Notes about this check",
+						Name:  "check-id",
+						Usage: "Check ID (defaults to the check name)",
 					},
 					cli.StringFlag{
-						Name:  "timeout,o",
-						Usage: "HTTP/TCP timeout",
+						Name:  "check-status",
+						Usage: "Check status (passing, warning or critical)",
+						Value: "critical",
+					},
+					cli.StringFlag{
+						Name:  "check-notes",
+						Usage: "Notes about this check",
 					},
 				},
 			},
 			{
 				Name:      "deregister",
 				Aliases:   []string{"rm"},
-				Usage:     "Remove a check",
-				ArgsUsage: "service-id",
-				Action:    DeregisterCheck,
+				Usage:     "Remove an external node, service or check",
+				ArgsUsage: "node-name",
+				Action:    CatalogDeregister,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "service-id,s",
+						Usage: "Only remove this service",
+					},
+					cli.StringFlag{
+						Name:  "check-id,c",
+						Usage: "Only remove this check",
+					},
+				},
+			},
+		},
+	}
+
+	aclFormatFlag = cli.StringFlag{
+		Name:  "format,f",
+		Usage: "Output format (table or json)",
+		Value: "table",
+	}
+
+	showSecretFlag = cli.BoolFlag{
+		Name:  "show-secret",
+		Usage: "Include the token's SecretID in json output",
+	}
+
+	aclTokenFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "description,d",
+			Usage: "Token description",
+		},
+		cli.StringSliceFlag{
+			Name:  "policy,p",
+			Usage: "Policy ID or name to attach (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "role,r",
+			Usage: "Role ID or name to attach (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "service-identity,s",
+			Usage: "Service identity as name[:dc1,dc2] (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "node-identity,n",
+			Usage: "Node identity as name[:dc] (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		cli.DurationFlag{
+			Name:  "ttl",
+			Usage: "Delete the token after this long",
+		},
+		aclFormatFlag,
+	}
+
+	aclPolicyFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "name,n",
+			Usage: "Policy name",
+		},
+		cli.StringFlag{
+			Name:  "description,d",
+			Usage: "Policy description",
+		},
+		cli.StringFlag{
+			Name:  "rules,r",
+			Usage: "Policy rules in HCL or JSON",
+		},
+		cli.StringFlag{
+			Name:  "rules-file",
+			Usage: "Read the policy rules from a file, - for stdin",
+		},
+		cli.BoolFlag{
+			Name:  "skip-lint",
+			Usage: "Submit the rules without checking them first",
+		},
+		cli.StringSliceFlag{
+			Name:  "valid-datacenter",
+			Usage: "Limit the policy to this datacenter (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		aclFormatFlag,
+	}
+
+	aclRoleFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "name,n",
+			Usage: "Role name",
+		},
+		cli.StringFlag{
+			Name:  "description,d",
+			Usage: "Role description",
+		},
+		cli.StringSliceFlag{
+			Name:  "policy,p",
+			Usage: "Policy ID or name to attach (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "service-identity,s",
+			Usage: "Service identity as name[:dc1,dc2] (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		cli.StringSliceFlag{
+			Name:  "node-identity",
+			Usage: "Node identity as name[:dc] (may be repeated)",
+			Value: &cli.StringSlice{},
+		},
+		aclFormatFlag,
+	}
+
+	aclAuthMethodFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "name,n",
+			Usage: "Auth method name",
+		},
+		cli.StringFlag{
+			Name:  "type",
+			Usage: "Auth method type, e.g. kubernetes, jwt or oidc",
+		},
+		cli.StringFlag{
+			Name:  "display-name",
+			Usage: "Name shown in UIs",
+		},
+		cli.StringFlag{
+			Name:  "description,d",
+			Usage: "Auth method description",
+		},
+		cli.DurationFlag{
+			Name:  "max-token-ttl",
+			Usage: "Lifetime of tokens created by logging in",
+		},
+		cli.StringFlag{
+			Name:  "token-locality",
+			Usage: "Create local or global tokens",
+		},
+		cli.StringFlag{
+			Name:  "config",
+			Usage: "Type specific configuration as a JSON object",
+		},
+		cli.StringFlag{
+			Name:  "config-file",
+			Usage: "Read the configuration from a JSON file",
+		},
+		aclFormatFlag,
+	}
+
+	aclBindingRuleFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "method,m",
+			Usage: "Auth method the rule applies to",
+		},
+		cli.StringFlag{
+			Name:  "description,d",
+			Usage: "Binding rule description",
+		},
+		cli.StringFlag{
+			Name:  "selector,s",
+			Usage: "Expression matching the identities the rule applies to",
+		},
+		cli.StringFlag{
+			Name:  "bind-type",
+			Usage: "What to bind to: service, node or role",
+		},
+		cli.StringFlag{
+			Name:  "bind-name",
+			Usage: "Name to bind, may use ${value.field} interpolation",
+		},
+		aclFormatFlag,
+	}
+
+	ACLTokenCommand = cli.Command{
+		Name:      "token",
+		Usage:     "Manage ACL tokens",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Aliases:   []string{"new"},
+				Usage:     "Create a token",
+				ArgsUsage: " ",
+				Action:    CreateToken,
+				Flags: append([]cli.Flag{
+					cli.StringFlag{
+						Name:  "accessor",
+						Usage: "Use this accessor ID instead of generating one",
+					},
+					cli.StringFlag{
+						Name:  "secret",
+						Usage: "Use this secret ID instead of generating one",
+					},
+					cli.BoolFlag{
+						Name:  "local",
+						Usage: "Create a datacenter local token",
+					},
+				}, aclTokenFlags...),
+			},
+			{
+				Name:      "read",
+				Aliases:   []string{"get"},
+				Usage:     "Show a token",
+				ArgsUsage: "accessor-id|self",
+				Action:    ReadToken,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+			{
+				Name:      "update",
+				Aliases:   []string{"up"},
+				Usage:     "Update a token, unset flags are left alone",
+				ArgsUsage: "accessor-id",
+				Action:    UpdateToken,
+				Flags:     aclTokenFlags,
+			},
+			{
+				Name:      "delete",
+				Aliases:   []string{"rm"},
+				Usage:     "Delete a token",
+				ArgsUsage: "accessor-id",
+				Action:    DeleteToken,
 			},
 			{
 				Name:      "list",
 				Aliases:   []string{"ls"},
-				Usage:     "List health check info",
+				Usage:     "List tokens",
 				ArgsUsage: " ",
-				Action:    ListChecks,
+				Action:    ListTokens,
+				Flags:     []cli.Flag{aclFormatFlag},
 			},
 			{
-				Name:    "update",
-				Aliases: []string{"up"},
-				Usage:   "Update TTL check",
-				Flags: []cli.Flag{
+				Name:      "info",
+				Usage:     "Show a token with its effective policies, roles, expiry and rules",
+				ArgsUsage: "accessor-id|self",
+				Action:    TokenInfo,
+				Flags:     []cli.Flag{aclFormatFlag, showSecretFlag},
+			},
+			{
+				Name:      "rotate",
+				Usage:     "Replace a token with a new one granting the same access",
+				ArgsUsage: "accessor-id",
+				Action:    RotateToken,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "description",
+						Usage: "Description for the new token, defaults to the old one's",
+					},
+					cli.StringFlag{
+						Name:  "kv",
+						Usage: "Write the new secret ID to this key",
+					},
+					cli.StringFlag{
+						Name:  "outfile,o",
+						Usage: "Write the new secret ID to a file with 0600 permissions",
+					},
+					cli.DurationFlag{
+						Name:  "grace",
+						Usage: "How long to keep the old token before deleting it",
+						Value: time.Minute,
+					},
+					cli.BoolFlag{
+						Name:  "keep-old",
+						Usage: "Don't delete the old token",
+					},
+					aclFormatFlag,
+				},
+			},
+		},
+	}
+
+	ACLPolicyCommand = cli.Command{
+		Name:      "policy",
+		Usage:     "Manage ACL policies",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Aliases:   []string{"new"},
+				Usage:     "Create a policy",
+				ArgsUsage: " ",
+				Action:    CreatePolicy,
+				Flags:     aclPolicyFlags,
+			},
+			{
+				Name:      "read",
+				Aliases:   []string{"get"},
+				Usage:     "Show a policy",
+				ArgsUsage: "policy-id|name",
+				Action:    ReadPolicy,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+			{
+				Name:      "update",
+				Aliases:   []string{"up"},
+				Usage:     "Update a policy, unset flags are left alone",
+				ArgsUsage: "policy-id|name",
+				Action:    UpdatePolicy,
+				Flags:     aclPolicyFlags,
+			},
+			{
+				Name:      "delete",
+				Aliases:   []string{"rm"},
+				Usage:     "Delete a policy",
+				ArgsUsage: "policy-id|name",
+				Action:    DeletePolicy,
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "List policies",
+				ArgsUsage: " ",
+				Action:    ListPolicies,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+		},
+	}
+
+	ACLRoleCommand = cli.Command{
+		Name:      "role",
+		Usage:     "Manage ACL roles",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Aliases:   []string{"new"},
+				Usage:     "Create a role",
+				ArgsUsage: " ",
+				Action:    CreateRole,
+				Flags:     aclRoleFlags,
+			},
+			{
+				Name:      "read",
+				Aliases:   []string{"get"},
+				Usage:     "Show a role",
+				ArgsUsage: "role-id|name",
+				Action:    ReadRole,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+			{
+				Name:      "update",
+				Aliases:   []string{"up"},
+				Usage:     "Update a role, unset flags are left alone",
+				ArgsUsage: "role-id|name",
+				Action:    UpdateRole,
+				Flags:     aclRoleFlags,
+			},
+			{
+				Name:      "delete",
+				Aliases:   []string{"rm"},
+				Usage:     "Delete a role",
+				ArgsUsage: "role-id|name",
+				Action:    DeleteRole,
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "List roles",
+				ArgsUsage: " ",
+				Action:    ListRoles,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+		},
+	}
+
+	ACLAuthMethodCommand = cli.Command{
+		Name:      "auth-method",
+		Usage:     "Manage ACL auth methods",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Aliases:   []string{"new"},
+				Usage:     "Create an auth method",
+				ArgsUsage: " ",
+				Action:    CreateAuthMethod,
+				Flags:     aclAuthMethodFlags,
+			},
+			{
+				Name:      "read",
+				Aliases:   []string{"get"},
+				Usage:     "Show an auth method",
+				ArgsUsage: "name",
+				Action:    ReadAuthMethod,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+			{
+				Name:      "update",
+				Aliases:   []string{"up"},
+				Usage:     "Update an auth method, unset flags are left alone",
+				ArgsUsage: "name",
+				Action:    UpdateAuthMethod,
+				Flags:     aclAuthMethodFlags,
+			},
+			{
+				Name:      "delete",
+				Aliases:   []string{"rm"},
+				Usage:     "Delete an auth method",
+				ArgsUsage: "name",
+				Action:    DeleteAuthMethod,
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "List auth methods",
+				ArgsUsage: " ",
+				Action:    ListAuthMethods,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+		},
+	}
+
+	ACLBindingRuleCommand = cli.Command{
+		Name:      "binding-rule",
+		Usage:     "Manage ACL binding rules",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "create",
+				Aliases:   []string{"new"},
+				Usage:     "Create a binding rule",
+				ArgsUsage: " ",
+				Action:    CreateBindingRule,
+				Flags:     aclBindingRuleFlags,
+			},
+			{
+				Name:      "read",
+				Aliases:   []string{"get"},
+				Usage:     "Show a binding rule",
+				ArgsUsage: "rule-id",
+				Action:    ReadBindingRule,
+				Flags:     []cli.Flag{aclFormatFlag},
+			},
+			{
+				Name:      "update",
+				Aliases:   []string{"up"},
+				Usage:     "Update a binding rule, unset flags are left alone",
+				ArgsUsage: "rule-id",
+				Action:    UpdateBindingRule,
+				Flags:     aclBindingRuleFlags,
+			},
+			{
+				Name:      "delete",
+				Aliases:   []string{"rm"},
+				Usage:     "Delete a binding rule",
+				ArgsUsage: "rule-id",
+				Action:    DeleteBindingRule,
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "List binding rules",
+				ArgsUsage: " ",
+				Action:    ListBindingRules,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "method,m",
+						Usage: "Only list rules for this auth method",
+					},
+					aclFormatFlag,
+				},
+			},
+		},
+	}
+
+	LoginCommand = cli.Command{
+		Name:      "login",
+		Usage:     "Exchange a bearer token for a Consul token and cache it",
+		ArgsUsage: " ",
+		Action:    Login,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "method,m",
+				Usage: "Auth method to log in with",
+			},
+			cli.StringFlag{
+				Name:  "bearer-token-file,f",
+				Usage: "File holding the bearer token, e.g. a JWT, or - for stdin",
+			},
+			cli.StringSliceFlag{
+				Name:  "meta",
+				Usage: "key=value metadata for the created token (may be repeated)",
+				Value: &cli.StringSlice{},
+			},
+			cli.BoolFlag{
+				Name:  "no-cache",
+				Usage: "Print the token instead of caching it",
+			},
+			aclFormatFlag,
+		},
+	}
+
+	LogoutCommand = cli.Command{
+		Name:      "logout",
+		Usage:     "Destroy the cached login token",
+		ArgsUsage: " ",
+		Action:    Logout,
+	}
+
+	ACLCommand = cli.Command{
+		Name:      "acl",
+		Usage:     "Manipulate the ACL catalog",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			ACLTokenCommand,
+			ACLPolicyCommand,
+			ACLRoleCommand,
+			ACLAuthMethodCommand,
+			ACLBindingRuleCommand,
+			{
+				Name:      "whoami",
+				Usage:     "Describe the token from --token or login",
+				ArgsUsage: " ",
+				Action:    WhoAmI,
+				Flags:     []cli.Flag{aclFormatFlag, showSecretFlag},
+			},
+			{
+				Name:      "can",
+				Usage:     "Check whether a token allows an operation, e.g. key:write app/config/db",
+				ArgsUsage: "resource:access [segment]",
+				Action:    ACLCan,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "token,as-token",
+						Usage: "Secret ID of the token to check, defaults to the one used for requests",
+					},
+					cli.StringFlag{
+						Name:  "accessor",
+						Usage: "Check the token with this accessor ID instead",
+					},
+					cli.StringFlag{
+						Name:  "file,f",
+						Usage: "Check every \"resource:access [segment]\" line in this file",
+					},
+					cli.StringFlag{
+						Name:  "default-policy",
+						Usage: "The cluster's acl default_policy, used when no rule matches",
+						Value: "deny",
+					},
+				},
+			},
+			{
+				Name:      "lint",
+				Usage:     "Check ACL rules files for mistakes",
+				ArgsUsage: "rules.hcl [rules.json...]",
+				Action:    LintACL,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "normalize,n",
+						Usage: "Print the rules sorted and consistently formatted",
+					},
+					cli.BoolFlag{
+						Name:  "strict,s",
+						Usage: "Fail on warnings as well as errors",
+					},
+				},
+			},
+			{
+				Name:      "apply",
+				Usage:     "Make policies, roles and tokens match a YAML file",
+				ArgsUsage: " ",
+				Action:    ApplyACL,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "file,f",
+						Usage: "YAML file declaring policies, roles and tokens",
+					},
+					cli.BoolFlag{
+						Name:  "dry-run,n",
+						Usage: "Only show the plan",
+					},
+					cli.BoolFlag{
+						Name:  "prune",
+						Usage: "Delete policies that aren't in the file",
+					},
+					cli.BoolFlag{
+						Name:  "show-secrets",
+						Usage: "Print the secret IDs of created tokens",
+					},
+					cli.BoolFlag{
+						Name:  "skip-lint",
+						Usage: "Submit the rules without checking them first",
+					},
+				},
+			},
+			{
+				Name:      "bootstrap",
+				Usage:     "Bootstrap the ACL system and get the first management token",
+				ArgsUsage: " ",
+				Action:    BootstrapACL,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "outfile,o",
+						Usage: "Write the secret ID to a file with 0600 permissions instead of printing it",
+					},
+					aclFormatFlag,
+				},
+			},
+			{
+				Name:      "replication",
+				Usage:     "Show ACL replication status in every datacenter",
+				ArgsUsage: " ",
+				Action:    ACLReplicationStatus,
+			},
+			{
+				Name:      "migrate-legacy",
+				Usage:     "Upgrade legacy tokens to policies",
+				ArgsUsage: " ",
+				Action:    MigrateLegacyACL,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "dry-run,n",
+						Usage: "Only show what would be migrated",
+					},
+				},
+			},
+			{
+				Name:      "register",
+				Aliases:   []string{"new"},
+				Usage:     "Create an ACL token (legacy)",
+				ArgsUsage: "'{\"rule\":\"json\"}'",
+				Action:    CreateACL,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "type,t",
+						Usage: "ACL Token type (client or management)",
+					},
+					cli.StringFlag{
+						Name:  "name,n",
+						Usage: "ACL name",
+					},
+					cli.StringFlag{
+						Name:  "id,i",
+						Usage: "ID of ACL",
+					},
+					cli.StringFlag{
+						Name:  "rules-file,f",
+						Usage: "Read the rules from a file instead of the argument, - for stdin",
+					},
+					cli.BoolFlag{
+						Name:  "skip-lint",
+						Usage: "Submit the rules without checking them first",
+					},
+				},
+			},
+			{
+				Name:      "deregister",
+				Aliases:   []string{"rm"},
+				Usage:     "Remove an ACL token (legacy)",
+				ArgsUsage: "service-id",
+				Action:    DeregisterACL,
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "List ACL tokens (legacy)",
+				ArgsUsage: " ",
+				Action:    ListACL,
+			},
+			{
+				Name:      "clone",
+				Usage:     "Clone a token into a new entry (legacy)",
+				ArgsUsage: " ",
+				Action:    CloneACL,
+			},
+			{
+				Name:      "update",
+				Aliases:   []string{"up"},
+				Usage:     "Update an ACL token (legacy)",
+				ArgsUsage: "'{\"rule\":\"json\"}'",
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "type,t",
+						Usage: "ACL Token type (client or management)",
+					},
+					cli.StringFlag{
+						Name:  "name,n",
+						Usage: "ACL name",
+					},
+					cli.StringFlag{
+						Name:  "id,i",
+						Usage: "ID of ACL (required)",
+					},
+					cli.StringFlag{
+						Name:  "rules-file,f",
+						Usage: "Read the rules from a file instead of the argument, - for stdin",
+					},
+					cli.BoolFlag{
+						Name:  "skip-lint",
+						Usage: "Submit the rules without checking them first",
+					},
+				},
+				Action: UpdateACL,
+			},
+		},
+	}
+
+	ExecCommand = cli.Command{
+		Name:      "exec",
+		Usage:     "Run a command on remote nodes, like consul exec",
+		ArgsUsage: "-- command [args...]",
+		Action:    RemoteExec,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "node,n",
+				Usage: "Node filter regex",
+			},
+			cli.StringFlag{
+				Name:  "service,s",
+				Usage: "Service filter regex",
+			},
+			cli.StringFlag{
+				Name:  "tag,t",
+				Usage: "Tag filter regex, requires --service",
+			},
+			cli.StringFlag{
+				Name:  "prefix",
+				Usage: "KV prefix for jobs and replies",
+				Value: "_rexec",
+			},
+			cli.DurationFlag{
+				Name:  "wait,w",
+				Usage: "How long to wait for replies after the last one",
+				Value: 2 * time.Second,
+			},
+			cli.DurationFlag{
+				Name:  "wait-repl",
+				Usage: "How long agents buffer output before writing it",
+				Value: 200 * time.Millisecond,
+			},
+		},
+	}
+
+	WaitForCommand = cli.Command{
+		Name:      "wait-for",
+		Usage:     "Block until Consul conditions are met",
+		ArgsUsage: " ",
+		Action:    WaitFor,
+		Flags: []cli.Flag{
+			cli.StringFlag{
+				Name:  "service,s",
+				Usage: "Wait for passing instances of this service",
+			},
+			cli.StringFlag{
+				Name:  "tag",
+				Usage: "Only count service instances with this tag",
+			},
+			cli.IntFlag{
+				Name:  "passing,n",
+				Usage: "Number of passing service instances to wait for",
+				Value: 1,
+			},
+			cli.StringFlag{
+				Name:  "key,k",
+				Usage: "Wait for this KV key to exist",
+			},
+			cli.StringFlag{
+				Name:  "value,v",
+				Usage: "Wait for the key to have this value",
+			},
+			cli.StringFlag{
+				Name:  "check,c",
+				Usage: "Wait for this check ID to reach --status",
+			},
+			cli.StringFlag{
+				Name:  "status",
+				Usage: "Check status to wait for",
+				Value: "passing",
+			},
+			cli.BoolFlag{
+				Name:  "leader,l",
+				Usage: "Wait for the cluster to elect a leader",
+			},
+			cli.DurationFlag{
+				Name:  "timeout,t",
+				Usage: "Exit non-zero if the conditions aren't met in time",
+				Value: 5 * time.Minute,
+			},
+			cli.DurationFlag{
+				Name:  "wait,w",
+				Usage: "Maximum blocking query wait time",
+				Value: time.Minute,
+			},
+		},
+	}
+
+	healthFilterFlags = []cli.Flag{
+		cli.StringFlag{
+			Name:  "status,s",
+			Usage: "Only show checks with this status",
+		},
+		cli.StringFlag{
+			Name:  "service",
+			Usage: "Only show checks for services matching this glob",
+		},
+		cli.StringFlag{
+			Name:  "node,n",
+			Usage: "Only show checks for nodes matching this glob",
+		},
+		cli.BoolFlag{
+			Name:  "summary",
+			Usage: "Show counts per state per service",
+		},
+	}
+
+	HealthCommand = cli.Command{
+		Name:      "health",
+		Usage:     "Query cluster-wide health",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "state",
+				Usage:     "List checks in a given state across the cluster",
+				ArgsUsage: "[passing|warning|critical|any]",
+				Action:    HealthState,
+				Flags:     healthFilterFlags,
+			},
+			{
+				Name:      "node",
+				Usage:     "List checks for a node",
+				ArgsUsage: "node-name",
+				Action:    HealthNode,
+				Flags:     healthFilterFlags,
+			},
+			{
+				Name:      "service",
+				Usage:     "List checks for a service",
+				ArgsUsage: "service-name",
+				Action:    HealthService,
+				Flags:     healthFilterFlags,
+			},
+			{
+				Name:      "probe",
+				Usage:     "Check conditions and exit with Nagios/Sensu status codes",
+				ArgsUsage: " ",
+				Action:    ProbeHealth,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "service,s",
+						Usage: "Service that must have enough passing instances",
+					},
+					cli.StringFlag{
+						Name:  "tag,t",
+						Usage: "Only count service instances with this tag",
+					},
+					cli.IntFlag{
+						Name:  "min-passing,c",
+						Usage: "Critical when fewer instances are passing",
+						Value: 1,
+					},
+					cli.IntFlag{
+						Name:  "warn-passing,w",
+						Usage: "Warning when fewer instances are passing",
+					},
+					cli.StringFlag{
+						Name:  "node,n",
+						Usage: "Node that must have no warning or critical checks",
+					},
+					cli.StringFlag{
+						Name:  "key,k",
+						Usage: "KV key that must exist",
+					},
+					cli.StringFlag{
+						Name:  "key-match,m",
+						Usage: "Regex the key's value must match",
+					},
+				},
+			},
+		},
+	}
+
+	CheckCommand = cli.Command{
+		Name:      "check",
+		Usage:     "Manipulate the health check catalog",
+		ArgsUsage: " ",
+		Subcommands: []cli.Command{
+			{
+				Name:      "register",
+				Aliases:   []string{"new"},
+				Usage:     "Create or edit a check",
+				ArgsUsage: "checkname",
+				Action:    RegisterCheck,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "file,f",
+						Usage: "Load the check definition from a JSON file, flags override it",
+					},
+					cli.StringFlag{
+						Name:  "id",
+						Usage: "Check ID (defaults to the check name)",
+					},
+					cli.StringFlag{
+						Name:  "http,h",
+						Usage: "HTTP check endpoint",
+					},
+					cli.StringFlag{
+						Name:  "method,m",
+						Usage: "HTTP check method",
+					},
+					cli.StringSliceFlag{
+						Name:  "header",
+						Usage: "HTTP check header as 'Name: value' (may be repeated)",
+						Value: &cli.StringSlice{},
+					},
+					cli.StringFlag{
+						Name:  "body",
+						Usage: "HTTP check request body",
+					},
+					cli.StringFlag{
+						Name:  "tcp,t",
+						Usage: "TCP check endpoint",
+					},
+					cli.StringFlag{
+						Name:  "grpc,g",
+						Usage: "gRPC check endpoint (host:port/service)",
+					},
+					cli.BoolFlag{
+						Name:  "grpc-tls",
+						Usage: "Use TLS for the gRPC check",
+					},
+					cli.BoolFlag{
+						Name:  "tls-skip-verify",
+						Usage: "Skip certificate verification for HTTP and gRPC checks",
+					},
+					cli.StringFlag{
+						Name:  "tls-server-name",
+						Usage: "SNI server name for HTTP and gRPC checks",
+					},
+					cli.StringFlag{
+						Name:  "docker-container-id,d",
+						Usage: "Docker container to run the check script in",
+					},
+					cli.StringFlag{
+						Name:  "shell",
+						Usage: "Shell to use for Docker checks",
+					},
+					cli.StringFlag{
+						Name:  "interval,i",
+						Usage: "Check interval",
+					},
+					cli.StringSliceFlag{
+						Name:  "args,a",
+						Usage: "Check command and arguments (repeat for each argument)",
+						Value: &cli.StringSlice{},
+					},
+					cli.StringFlag{
+						Name:  "script,x",
+						Usage: "Check script, run with /bin/sh -c (deprecated, use --args)",
+					},
+					cli.StringFlag{
+						Name:  "ttl,l",
+						Usage: "Check TTL",
+					},
+					cli.StringFlag{
+						Name:  "service,s",
+						Usage: "Service ID to associate with this check",
+					},
+					cli.StringFlag{
+						Name:  "notes,n",
+						Usage: "Notes about this check",
+					},
+					cli.StringFlag{
+						Name:  "timeout,o",
+						Usage: "HTTP/TCP timeout",
+					},
+					cli.StringFlag{
+						Name:  "status",
+						Usage: "Initial check status (passing, warning or critical)",
+					},
+					cli.StringFlag{
+						Name:  "deregister-after",
+						Usage: "Deregister the service after the check is critical this long",
+					},
+				},
+			},
+			{
+				Name:      "deregister",
+				Aliases:   []string{"rm"},
+				Usage:     "Remove a check",
+				ArgsUsage: "service-id",
+				Action:    DeregisterCheck,
+			},
+			{
+				Name:      "list",
+				Aliases:   []string{"ls"},
+				Usage:     "List health check info",
+				ArgsUsage: " ",
+				Action:    ListChecks,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "status,s",
+						Usage: "Only show checks with this status",
+					},
+					cli.StringFlag{
+						Name:  "service",
+						Usage: "Only show checks for this service ID or name",
+					},
+				},
+			},
+			{
+				Name:      "get",
+				Usage:     "Show a check including its full output",
+				ArgsUsage: "check-id",
+				Action:    GetCheck,
+				Flags: []cli.Flag{
+					cli.BoolFlag{
+						Name:  "watch,w",
+						Usage: "Keep running and show status transitions",
+					},
+					cli.IntFlag{
+						Name:  "history",
+						Usage: "Number of transitions to keep while watching",
+						Value: 10,
+					},
+				},
+			},
+			{
+				Name:    "update",
+				Aliases: []string{"up"},
+				Usage:   "Update TTL check",
+				Flags: []cli.Flag{
 					cli.StringFlag{
 						Name:  "note,n",
 						Usage: "Notes for this update",
@@ -383,6 +1586,55 @@ var (
 				ArgsUsage: "check-id [pass|fail|warn]",
 				Action:    UpdateCheck,
 			},
+			{
+				Name:      "heartbeat",
+				Usage:     "Keep a TTL check updated from a local probe",
+				ArgsUsage: "check-id",
+				Action:    HeartbeatCheck,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "cmd,c",
+						Usage: "Probe command, exit 0 passes, 1 warns, anything else fails",
+					},
+					cli.DurationFlag{
+						Name:  "every,e",
+						Usage: "How often to run the probe",
+						Value: 10 * time.Second,
+					},
+					cli.DurationFlag{
+						Name:  "timeout,o",
+						Usage: "Fail the probe if it runs longer than this",
+						Value: 5 * time.Second,
+					},
+					cli.IntFlag{
+						Name:  "max-output",
+						Usage: "Truncate probe output sent as the note to this many bytes",
+						Value: 4096,
+					},
+				},
+			},
+			{
+				Name:      "runner",
+				Usage:     "Run probes locally and report them to TTL checks",
+				ArgsUsage: " ",
+				Action:    RunChecks,
+				Flags: []cli.Flag{
+					cli.StringFlag{
+						Name:  "file,f",
+						Usage: "YAML or JSON file describing the checks",
+					},
+					cli.IntFlag{
+						Name:  "concurrency,c",
+						Usage: "Maximum number of probes running at once",
+						Value: 4,
+					},
+					cli.Float64Flag{
+						Name:  "jitter,j",
+						Usage: "Random delay added to each interval, as a fraction of it",
+						Value: 0.1,
+					},
+				},
+			},
 		},
 	}
 )
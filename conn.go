@@ -81,6 +81,15 @@ func NewAppConfig(c *cli.Context) (cfg *AppConfig, err error) {
 	config.Address = consulUrl.Host
 	config.Datacenter = c.GlobalString("datacenter")
 
+	// An explicit --token wins over one cached by login
+	token := c.GlobalString("token")
+	if len(token) < 1 {
+		token = cachedLoginToken(c)
+	}
+
+	// Some endpoints, like rules translation, only use the client's token
+	config.Token = token
+
 	// Check for insecure flag
 	if c.GlobalBool("insecure") {
 		tlsConf.InsecureSkipVerify = true
@@ -132,11 +141,11 @@ func NewAppConfig(c *cli.Context) (cfg *AppConfig, err error) {
 		client: cl,
 		queryOpts: &api.QueryOptions{
 			Datacenter: c.GlobalString("datacenter"),
-			Token:      c.GlobalString("token"),
+			Token:      token,
 		},
 		writeOpts: &api.WriteOptions{
 			Datacenter: c.GlobalString("datacenter"),
-			Token:      c.GlobalString("token"),
+			Token:      token,
 		},
 	}
 	return
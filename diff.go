@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"strings"
+)
+
+// catalogDrift is one difference between the local agent and the catalog
+type catalogDrift struct {
+	Kind    string
+	ID      string
+	Problem string
+}
+
+// DiffServices compares the services and checks the local agent knows about
+// with what the catalog reports for this node. Exits non-zero on drift.
+func DiffServices(c *cli.Context) {
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	agent := cfg.client.Agent()
+
+	nodeName, err := agent.NodeName()
+	if err != nil {
+		log.Fatalf("Could not get agent node name: %v", err)
+	}
+	agentServices, err := agent.Services()
+	if err != nil {
+		log.Fatalf("Failed to list agent services: %v", err)
+	}
+	agentChecks, err := agent.Checks()
+	if err != nil {
+		log.Fatalf("Failed to list agent checks: %v", err)
+	}
+
+	node, _, err := cfg.client.Catalog().Node(nodeName, cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Failed to load catalog node: %v", err)
+	}
+	catalogChecks, _, err := cfg.client.Health().Node(nodeName, cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Failed to load catalog checks: %v", err)
+	}
+
+	drift := []*catalogDrift{}
+	if node == nil {
+		drift = append(drift, &catalogDrift{"node", nodeName, "missing from catalog"})
+	} else {
+		for id, svc := range agentServices {
+			cs, ok := node.Services[id]
+			if !ok {
+				drift = append(drift, &catalogDrift{"service", id, "not synced to catalog"})
+				continue
+			}
+			if diff := diffAgentServices(svc, cs); len(diff) > 0 {
+				drift = append(drift, &catalogDrift{"service", id, "catalog has " + strings.Join(diff, ", ")})
+			}
+		}
+		for id := range node.Services {
+			// The leader manages the consul service on servers, the agent never has it
+			if id == "consul" {
+				continue
+			}
+			if _, ok := agentServices[id]; !ok {
+				drift = append(drift, &catalogDrift{"service", id, "orphaned in catalog"})
+			}
+		}
+	}
+
+	catalogCheckIDs := map[string]bool{}
+	for _, cc := range catalogChecks {
+		catalogCheckIDs[cc.CheckID] = true
+		ac, ok := agentChecks[cc.CheckID]
+		if !ok {
+			// The serf health check only exists in the catalog
+			if cc.CheckID != "serfHealth" {
+				drift = append(drift, &catalogDrift{"check", cc.CheckID, "orphaned in catalog"})
+			}
+			continue
+		}
+		if ac.Status != cc.Status {
+			drift = append(drift, &catalogDrift{"check", cc.CheckID,
+				fmt.Sprintf("status %s on agent, %s in catalog", ac.Status, cc.Status)})
+		}
+		if ac.ServiceID != cc.ServiceID {
+			drift = append(drift, &catalogDrift{"check", cc.CheckID,
+				fmt.Sprintf("service %q on agent, %q in catalog", ac.ServiceID, cc.ServiceID)})
+		}
+	}
+	for id := range agentChecks {
+		if !catalogCheckIDs[id] {
+			drift = append(drift, &catalogDrift{"check", id, "not synced to catalog"})
+		}
+	}
+
+	sort.Slice(drift, func(i, j int) bool {
+		if drift[i].Kind != drift[j].Kind {
+			return drift[i].Kind > drift[j].Kind
+		}
+		return drift[i].ID < drift[j].ID
+	})
+
+	if c.GlobalBool("verbose") {
+		dumpJson(drift)
+	} else if len(drift) > 0 {
+		w := getTabwriter()
+		fmt.Fprintf(w, "Kind\tID\tProblem\n")
+		for _, d := range drift {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", d.Kind, d.ID, d.Problem)
+		}
+		w.Flush()
+	}
+
+	if len(drift) > 0 {
+		log.Exit(1)
+	}
+	log.Printf("Agent and catalog agree on %s", nodeName)
+}
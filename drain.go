@@ -0,0 +1,70 @@
+package main
+
+import (
+	"github.com/codegangsta/cli"
+	log "github.com/sirupsen/logrus"
+	"time"
+)
+
+// DrainService puts a local service into maintenance mode, waits for
+// traffic to stop and optionally deregisters it. Failures exit non-zero
+// so the drain can be chained in scripts.
+func DrainService(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("service ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+	id := c.Args().First()
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	agent := cfg.client.Agent()
+
+	services, err := agent.Services()
+	if err != nil {
+		log.Fatalf("Failed to list agent services: %v", err)
+	}
+	if _, ok := services[id]; !ok {
+		log.Fatalf("Service %s is not registered with this agent", id)
+	}
+
+	steps := 2
+	if c.Bool("deregister") {
+		steps = 3
+	}
+
+	log.Infof("[1/%d] Enabling maintenance mode on %s", steps, id)
+	if err = agent.EnableServiceMaintenance(id, c.String("reason")); err != nil {
+		log.Fatalf("Error setting maintenance mode: %v", err)
+	}
+
+	if len(c.String("until")) > 0 {
+		log.Infof("[2/%d] Waiting up to %s for '%s' to succeed", steps, c.Duration("timeout"), c.String("until"))
+		deadline := time.Now().Add(c.Duration("timeout"))
+		for {
+			if err := runHook(c.String("until"), nil, []string{"CONSUL_SERVICE_ID=" + id}); err == nil {
+				break
+			}
+			if time.Now().After(deadline) {
+				log.Fatalf("Timed out waiting for %s to drain", id)
+			}
+			time.Sleep(c.Duration("interval"))
+		}
+	} else {
+		log.Infof("[2/%d] Waiting %s for connections to drain", steps, c.Duration("delay"))
+		time.Sleep(c.Duration("delay"))
+	}
+
+	if c.Bool("deregister") {
+		log.Infof("[3/%d] Deregistering %s", steps, id)
+		if err = agent.ServiceDeregister(id); err != nil {
+			log.Fatalf("Error removing service: %v", err)
+		}
+	}
+
+	log.Println("Success")
+}
@@ -1,56 +1,347 @@
 package main
 
 import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"github.com/codegangsta/cli"
 	"github.com/hashicorp/consul/api"
 	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
 )
 
 func ListEvents(c *cli.Context) {
+	if f := c.String("payload-format"); !stringArrayContains(f, eventPayloadFormats) {
+		log.Errorf("Unknown payload format %q, must be one of %s", f, strings.Join(eventPayloadFormats, ", "))
+		log.Exit(2)
+	}
+	var nodeFilter *regexp.Regexp
+	if len(c.String("node-filter")) > 0 {
+		var err error
+		if nodeFilter, err = regexp.Compile(c.String("node-filter")); err != nil {
+			log.Errorf("Invalid --node-filter: %v", err)
+			log.Exit(2)
+		}
+	}
+
 	cfg, err := NewAppConfig(c)
 	if err != nil {
-		log.Errorf("Failed to get client: %v", err)
-		return
+		log.Fatalf("Failed to get client: %v", err)
 	}
 
-	events, _, err := cfg.client.Event().List(c.Args().First(), cfg.queryOpts)
+	name := c.String("name")
+	if len(name) < 1 {
+		name = c.Args().First()
+	}
+	events, _, err := cfg.client.Event().List(name, cfg.queryOpts)
 	if err != nil {
-		log.Errorf("Failed to list events: %v", err)
-		return
+		log.Fatalf("Failed to list events: %v", err)
+	}
+
+	// LTime is the cluster's logical clock, so it orders events
+	// even though they carry no wall clock time
+	sort.SliceStable(events, func(i, j int) bool { return events[i].LTime < events[j].LTime })
+	filtered := []*api.UserEvent{}
+	for _, e := range events {
+		if c.IsSet("since") && e.LTime <= uint64(c.Int64("since")) {
+			continue
+		}
+		if nodeFilter != nil && !nodeFilter.MatchString(e.NodeFilter) {
+			continue
+		}
+		filtered = append(filtered, e)
+	}
+	if last := c.Int("last"); last > 0 && len(filtered) > last {
+		filtered = filtered[len(filtered)-last:]
 	}
 
 	if c.GlobalBool("verbose") {
-		dumpJson(events)
+		dumpJson(filtered)
 		return
 	}
-	prettyPrintEvents(events)
+	prettyPrintEvents(filtered, c.String("payload-format"))
+}
+
+// Consul msgpack encodes the event with its ID, version and Lamport time,
+// and serf wraps that again with the prefixed name before checking it
+// against its 512 byte limit. This is a little more than both add.
+const eventEncodingOverhead = 192
+
+// encodedEventSize estimates the size serf sees, the name is counted
+// twice since both Consul and serf include it
+func encodedEventSize(e *api.UserEvent) int {
+	return eventEncodingOverhead + 2*len(e.Name) + len(e.Payload) +
+		len(e.NodeFilter) + len(e.ServiceFilter) + len(e.TagFilter)
 }
 
+var eventPayloadFormats = []string{"text", "json", "base64", "hex"}
+
 func FireEvent(c *cli.Context) {
-	if len(c.Args().First()) < 1 || len(c.Args().Tail()) < 1 {
-		log.Errorln("name and payload are required")
+	if len(c.Args().First()) < 1 || (len(c.Args().Tail()) < 1 && len(c.String("template")) < 1) {
+		log.Errorln("name and payload (or --template) are required")
 		cli.ShowAppHelp(c)
-		return
+		log.Exit(2)
 	}
 	cfg, err := NewAppConfig(c)
 	if err != nil {
-		log.Errorf("Failed to get client: %v", err)
-		return
+		log.Fatalf("Failed to get client: %v", err)
 	}
 
-	event := &api.UserEvent{
-		Name:          c.Args().First(),
-		Payload:       []byte(c.Args().Tail()[0]),
-		NodeFilter:    c.String("node"),
-		ServiceFilter: c.String("service"),
-		TagFilter:     c.String("tag"),
+	name := c.Args().First()
+	payload := loadEventPayload(c)
+
+	datacenters := []string{c.GlobalString("datacenter")}
+	if c.Bool("all-datacenters") {
+		if datacenters, err = cfg.client.Catalog().Datacenters(); err != nil {
+			log.Fatalf("Could not list datacenters: %v", err)
+		}
+	}
+
+	// Render everything up front so a bad template or oversized
+	// payload doesn't leave the event fired in only some datacenters
+	payloads := map[string][]byte{}
+	for _, dc := range datacenters {
+		p, err := payload(dc)
+		if err != nil {
+			log.Fatalf("Invalid payload: %v", err)
+		}
+		event := &api.UserEvent{
+			Name:          name,
+			Payload:       p,
+			NodeFilter:    c.String("node"),
+			ServiceFilter: c.String("service"),
+			TagFilter:     c.String("tag"),
+		}
+		if size := encodedEventSize(event); size > c.Int("max-size") {
+			log.Fatalf("Event is about %d bytes once encoded, more than the %d byte limit", size, c.Int("max-size"))
+		}
+		payloads[dc] = p
+	}
+
+	w := getTabwriter()
+	if len(datacenters) > 1 {
+		fmt.Fprintf(w, "Datacenter\tEventID\tError\n")
+	}
+	failed := 0
+	for _, dc := range datacenters {
+		event := &api.UserEvent{
+			Name:          name,
+			Payload:       payloads[dc],
+			NodeFilter:    c.String("node"),
+			ServiceFilter: c.String("service"),
+			TagFilter:     c.String("tag"),
+		}
+		opts := *cfg.writeOpts
+		opts.Datacenter = dc
+		eid, _, err := cfg.client.Event().Fire(event, &opts)
+
+		if len(datacenters) < 2 {
+			if err != nil {
+				log.Fatalf("Could not fire event: %v", err)
+			}
+			fmt.Println(eid)
+			return
+		}
+		errMsg := ""
+		if err != nil {
+			errMsg = err.Error()
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", dc, eid, errMsg)
 	}
-	eid, _, err := cfg.client.Event().Fire(event, cfg.writeOpts)
+	w.Flush()
 
+	if failed > 0 {
+		log.Fatalf("Event could not be fired in %d of %d datacenters", failed, len(datacenters))
+	}
+}
+
+// loadEventPayload returns a function rendering the payload for a
+// datacenter. The payload argument can be a literal, @file or - for
+// stdin. A --template is rendered with the datacenter, the event name
+// and --var values, and must produce JSON.
+func loadEventPayload(c *cli.Context) func(dc string) ([]byte, error) {
+	if path := c.String("template"); len(path) > 0 {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Fatalf("Could not read template: %v", err)
+		}
+		tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Parse(string(b))
+		if err != nil {
+			log.Fatalf("Could not parse template: %v", err)
+		}
+		vars, err := parseKeyValues(c.StringSlice("var"))
+		if err != nil {
+			log.Fatalf("Invalid --var: %v", err)
+		}
+
+		return func(dc string) ([]byte, error) {
+			buf := &bytes.Buffer{}
+			err := tmpl.Execute(buf, map[string]interface{}{
+				"Datacenter": dc,
+				"Name":       c.Args().First(),
+				"Time":       time.Now().UTC().Format(time.RFC3339),
+				"Vars":       vars,
+			})
+			if err != nil {
+				return nil, err
+			}
+			// Compact it, every byte counts against the event size limit
+			compact := &bytes.Buffer{}
+			if err = json.Compact(compact, buf.Bytes()); err != nil {
+				return nil, fmt.Errorf("template didn't produce valid JSON: %v", err)
+			}
+			return compact.Bytes(), nil
+		}
+	}
+
+	var (
+		payload []byte
+		err     error
+	)
+	switch arg := c.Args().Tail()[0]; {
+	case arg == "-":
+		payload, err = ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(arg, "@"):
+		payload, err = ioutil.ReadFile(arg[1:])
+	default:
+		payload = []byte(arg)
+	}
 	if err != nil {
-		log.Errorf("Could not fire event: %v", err)
+		log.Fatalf("Could not read payload: %v", err)
+	}
+	return func(string) ([]byte, error) { return payload, nil }
+}
+
+// WatchEvents streams new events as they arrive. The events endpoint
+// has no real index, so the wait index is derived from the ID of the
+// newest event, and IDs already seen are skipped after a reconnect.
+func WatchEvents(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	name := c.Args().First()
+	ev := cfg.client.Event()
+	seen := map[string]bool{}
+	first := true
+	var index uint64
+
+	for {
+		events, meta, err := ev.List(name, blockingQueryOpts(cfg.queryOpts, index, c.Duration("wait")))
+		if err != nil {
+			log.Errorf("Failed to list events: %v", err)
+			time.Sleep(c.Duration("retry"))
+			continue
+		}
+
+		// The agent only keeps recent events, anything that dropped out
+		// of the list can't come back so there's no need to remember it
+		current := map[string]bool{}
+		for _, e := range events {
+			current[e.ID] = true
+			if seen[e.ID] || (first && !c.Bool("replay")) {
+				continue
+			}
+			handleEvent(c, e)
+		}
+		seen = current
+		first = false
+
+		switch {
+		case len(events) > 0:
+			index = ev.IDToIndex(events[len(events)-1].ID)
+		case meta.LastIndex > 0:
+			index = meta.LastIndex
+		default:
+			// Without an index the query wouldn't block, don't spin
+			time.Sleep(c.Duration("retry"))
+		}
+	}
+}
+
+func handleEvent(c *cli.Context, e *api.UserEvent) {
+	if c.GlobalBool("verbose") {
+		dumpJson(e)
+	} else {
+		fmt.Printf("%s %s %s ltime=%d %s\n", time.Now().Format(time.RFC3339), e.ID, e.Name, e.LTime, string(e.Payload))
+	}
+
+	if len(c.String("handler")) < 1 {
 		return
 	}
-	fmt.Println(eid)
+	env := []string{
+		"CONSUL_EVENT_ID=" + e.ID,
+		"CONSUL_EVENT_NAME=" + e.Name,
+		"CONSUL_EVENT_LTIME=" + strconv.FormatUint(e.LTime, 10),
+		"CONSUL_EVENT_VERSION=" + strconv.Itoa(e.Version),
+		"CONSUL_EVENT_NODE_FILTER=" + e.NodeFilter,
+		"CONSUL_EVENT_SERVICE_FILTER=" + e.ServiceFilter,
+		"CONSUL_EVENT_TAG_FILTER=" + e.TagFilter,
+	}
+	if err := runHook(c.String("handler"), e.Payload, env); err != nil {
+		log.Errorf("Handler failed for event %s: %v", e.ID, err)
+	}
+}
+
+// decodeEventPayload renders a payload for display
+func decodeEventPayload(payload []byte, format string) string {
+	switch format {
+	case "json":
+		buf := &bytes.Buffer{}
+		if err := json.Indent(buf, payload, "", "  "); err != nil {
+			// Not everything is JSON, show it as it is
+			return string(payload)
+		}
+		return buf.String()
+	case "base64":
+		return base64.StdEncoding.EncodeToString(payload)
+	case "hex":
+		return hex.EncodeToString(payload)
+	}
+	return string(payload)
+}
+
+// eventAge works out how old an event is from a "time" or "timestamp"
+// field in a JSON payload, such as the one templates get as .Time.
+// Consul doesn't record when events were fired, so it's 0 otherwise.
+func eventAge(e *api.UserEvent) time.Duration {
+	fields := map[string]interface{}{}
+	if json.Unmarshal(e.Payload, &fields) != nil {
+		return 0
+	}
+	for _, k := range []string{"time", "timestamp", "Time", "Timestamp"} {
+		if s, ok := fields[k].(string); ok {
+			if t, err := time.Parse(time.RFC3339, s); err == nil {
+				return time.Since(t)
+			}
+		}
+	}
+	return 0
+}
+
+// formatAge renders a duration the way people say it, e.g. 3m or 2d
+func formatAge(d time.Duration) string {
+	switch {
+	case d <= 0:
+		return "-"
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dd", int(d.Hours()/24))
 }
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// rexecSpec is the job agents read from <prefix>/<session>/job,
+// the same layout the consul binary's exec command writes
+type rexecSpec struct {
+	Command string        `json:",omitempty"`
+	Args    []string      `json:",omitempty"`
+	Script  []byte        `json:",omitempty"`
+	Wait    time.Duration `json:",omitempty"`
+}
+
+// rexecEvent is the payload of the _rexec event, telling agents where the job is
+type rexecEvent struct {
+	Prefix  string
+	Session string
+}
+
+// rexecNode tracks the replies from one node
+type rexecNode struct {
+	acked    bool
+	finished bool
+	exitCode int
+}
+
+// RemoteExec runs a command on the matching nodes with Consul's remote
+// exec protocol. Agents ack the _rexec event, run the job and write
+// their output and exit code back under the session's prefix.
+func RemoteExec(c *cli.Context) {
+	if !c.Args().Present() {
+		log.Errorln("a command is required, e.g. consulctl exec -- uptime")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	prefix := strings.Trim(c.String("prefix"), "/")
+
+	// Agents write their replies while holding the session, and with the
+	// delete behavior everything is cleaned up if we go away
+	session := cfg.client.Session()
+	id, _, err := session.Create(&api.SessionEntry{
+		Name:     "Remote Exec",
+		Behavior: api.SessionBehaviorDelete,
+		TTL:      "15s",
+	}, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create session: %v", err)
+	}
+	stopRenew := make(chan struct{})
+	go session.RenewPeriodic("15s", id, cfg.writeOpts, stopRenew)
+
+	dir := prefix + "/" + id + "/"
+	cleanup := func() {
+		close(stopRenew)
+		if _, err := session.Destroy(id, cfg.writeOpts); err != nil {
+			log.Warnf("Could not destroy session %s: %v", id, err)
+		}
+		if _, err := cfg.client.KV().DeleteTree(dir, cfg.writeOpts); err != nil {
+			log.Warnf("Could not clean up %s: %v", dir, err)
+		}
+	}
+
+	spec, _ := json.Marshal(&rexecSpec{
+		Command: strings.Join(c.Args(), " "),
+		Wait:    c.Duration("wait-repl"),
+	})
+	ok, _, err := cfg.client.KV().Acquire(&api.KVPair{Key: dir + "job", Value: spec, Session: id}, cfg.writeOpts)
+	if err != nil || !ok {
+		cleanup()
+		log.Fatalf("Could not write job to %sjob: %v", dir, err)
+	}
+
+	payload, _ := json.Marshal(&rexecEvent{Prefix: prefix, Session: id})
+	eid, _, err := cfg.client.Event().Fire(&api.UserEvent{
+		Name:          "_rexec",
+		Payload:       payload,
+		NodeFilter:    c.String("node"),
+		ServiceFilter: c.String("service"),
+		TagFilter:     c.String("tag"),
+	}, cfg.writeOpts)
+	if err != nil {
+		cleanup()
+		log.Fatalf("Could not fire event: %v", err)
+	}
+	log.Infof("Fired event %s, waiting for replies", eid)
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	replies := make(chan []string)
+	go watchRexecReplies(cfg, dir, c.Duration("wait"), replies)
+
+	nodes := map[string]*rexecNode{}
+	seen := map[string]bool{}
+	interrupted := false
+	for done := false; !done; {
+		select {
+		case <-sigs:
+			interrupted = true
+			done = true
+		case keys, open := <-replies:
+			if !open {
+				done = true
+				break
+			}
+			for _, key := range keys {
+				if seen[key] {
+					continue
+				}
+				seen[key] = true
+				handleRexecReply(cfg, dir, key, nodes)
+			}
+		}
+	}
+	cleanup()
+
+	if printRexecSummary(nodes) || interrupted {
+		log.Exit(1)
+	}
+}
+
+// watchRexecReplies sends the keys under dir whenever they change, and
+// closes the channel once nothing has changed for the wait time
+func watchRexecReplies(cfg *AppConfig, dir string, wait time.Duration, replies chan<- []string) {
+	defer close(replies)
+	var index uint64
+	for {
+		keys, meta, err := cfg.client.KV().Keys(dir, "", blockingQueryOpts(cfg.queryOpts, index, wait))
+		if err != nil {
+			log.Errorf("Failed to list replies: %v", err)
+			return
+		}
+		if index > 0 && meta.LastIndex == index {
+			return
+		}
+		index = meta.LastIndex
+		replies <- keys
+	}
+}
+
+// handleRexecReply records a reply key and prints output as it arrives.
+// Keys look like <node>/ack, <node>/exit and <node>/out/<seq>.
+func handleRexecReply(cfg *AppConfig, dir, key string, nodes map[string]*rexecNode) {
+	split := strings.SplitN(strings.TrimPrefix(key, dir), "/", 2)
+	if len(split) < 2 {
+		return
+	}
+	name, kind := split[0], split[1]
+	node, ok := nodes[name]
+	if !ok {
+		node = &rexecNode{}
+		nodes[name] = node
+	}
+
+	switch {
+	case kind == "ack":
+		node.acked = true
+		fmt.Printf("    %s: acknowledged\n", name)
+
+	case kind == "exit":
+		pair, _, err := cfg.client.KV().Get(key, cfg.queryOpts)
+		if err != nil || pair == nil {
+			log.Errorf("Could not read exit code of %s: %v", name, err)
+			return
+		}
+		node.finished = true
+		node.exitCode, err = strconv.Atoi(string(pair.Value))
+		if err != nil {
+			node.exitCode = -1
+		}
+		fmt.Printf("==> %s: finished with exit code %d\n", name, node.exitCode)
+
+	case strings.HasPrefix(kind, "out/"):
+		pair, _, err := cfg.client.KV().Get(key, cfg.queryOpts)
+		if err != nil || pair == nil {
+			log.Errorf("Could not read output of %s: %v", name, err)
+			return
+		}
+		for _, line := range strings.Split(strings.TrimRight(string(pair.Value), "\n"), "\n") {
+			fmt.Printf("    %s: %s\n", name, line)
+		}
+	}
+}
+
+// printRexecSummary prints the per node results and returns true if any
+// node failed or never finished
+func printRexecSummary(nodes map[string]*rexecNode) bool {
+	names := []string{}
+	for name := range nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	acked, finished, failed := 0, 0, 0
+	fmt.Println()
+	w := getTabwriter()
+	fmt.Fprintf(w, "Node\tResult\n")
+	for _, name := range names {
+		n := nodes[name]
+		result := "no exit code"
+		if n.acked {
+			acked++
+		}
+		if n.finished {
+			finished++
+			result = fmt.Sprintf("exit %d", n.exitCode)
+		}
+		if !n.finished || n.exitCode != 0 {
+			failed++
+		}
+		fmt.Fprintf(w, "%s\t%s\n", name, result)
+	}
+	w.Flush()
+	fmt.Printf("%d / %d node(s) completed / acknowledged, %d failed\n", finished, acked, failed)
+	return failed > 0 || len(nodes) < 1
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// exportedService is a service and its healthy instances, sorted
+// so that rendered output only changes when the instances do
+type exportedService struct {
+	Name      string
+	Instances []*api.ServiceEntry
+}
+
+var exportRenderers = map[string]func([]*exportedService) ([]byte, error){
+	"haproxy":       renderHAProxy,
+	"nginx":         renderNginx,
+	"envoy-eds":     renderEnvoyEDS,
+	"prometheus-sd": renderPrometheusSD,
+}
+
+func ExportServices(c *cli.Context) {
+	render, ok := exportRenderers[c.String("format")]
+	if !ok {
+		log.Errorf("Unknown format %q, must be haproxy, nginx, envoy-eds or prometheus-sd", c.String("format"))
+		log.Exit(2)
+	}
+	if c.Bool("watch") && len(c.String("outfile")) < 1 {
+		log.Errorln("--outfile is required with --watch")
+		log.Exit(2)
+	}
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	names := append([]string{}, c.Args()...)
+	var (
+		index uint64
+		last  []byte
+	)
+
+	for {
+		// Services that were not named explicitly are looked up on every pass
+		// so registrations show up in watch mode
+		selected := names
+		if len(selected) < 1 {
+			if selected, err = exportServiceNames(cfg); err != nil {
+				log.Errorf("Failed to list services: %v", err)
+				if !c.Bool("watch") {
+					log.Exit(1)
+				}
+				time.Sleep(c.Duration("retry"))
+				continue
+			}
+		}
+
+		services, err := loadExportedServices(cfg, selected, c.String("tag"))
+		if err != nil {
+			log.Errorf("Failed to load service health: %v", err)
+			if !c.Bool("watch") {
+				log.Exit(1)
+			}
+			time.Sleep(c.Duration("retry"))
+			continue
+		}
+
+		out, err := render(services)
+		if err != nil {
+			log.Fatalf("Failed to render %s config: %v", c.String("format"), err)
+		}
+
+		if !bytes.Equal(out, last) {
+			if len(c.String("outfile")) < 1 {
+				fmt.Print(string(out))
+				last = out
+			} else if err := writeFileAtomic(c.String("outfile"), out, 0644); err != nil {
+				// Leave last alone so the write is retried, and don't
+				// reload a proxy against the stale file
+				log.Errorf("Could not write %s: %v", c.String("outfile"), err)
+				if !c.Bool("watch") {
+					log.Exit(1)
+				}
+				time.Sleep(c.Duration("retry"))
+				continue
+			} else {
+				log.Infof("Wrote %s", c.String("outfile"))
+				last = out
+
+				// The first write reloads too, a proxy that is already
+				// running has to pick up the file. The reload command
+				// should cope with the proxy not running yet.
+				if len(c.String("reload")) > 0 {
+					if err := runHook(c.String("reload"), nil, nil); err != nil {
+						log.Errorf("Reload command failed: %v", err)
+						if !c.Bool("watch") {
+							log.Exit(1)
+						}
+					}
+				}
+			}
+		}
+
+		if !c.Bool("watch") {
+			return
+		}
+
+		// Any check change in the cluster bumps this index, the wait time
+		// bounds how long a new service without checks goes unnoticed
+		_, meta, err := cfg.client.Health().State(api.HealthAny,
+			blockingQueryOpts(cfg.queryOpts, index, c.Duration("wait")))
+		if err != nil {
+			log.Errorf("Failed to watch health: %v", err)
+			time.Sleep(c.Duration("retry"))
+			continue
+		}
+		if meta.LastIndex < index {
+			index = 0
+			continue
+		}
+		index = meta.LastIndex
+	}
+}
+
+// exportServiceNames returns the unique service names in the catalog
+func exportServiceNames(cfg *AppConfig) ([]string, error) {
+	svcs, err := parseCatalogServices(cfg.client.Catalog(), cfg.queryOpts)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, s := range svcs {
+		// Consul's own service has no useful backends
+		if s.ServiceName == "consul" {
+			continue
+		}
+		names = appendUnique(s.ServiceName, names)
+	}
+	return names, nil
+}
+
+func loadExportedServices(cfg *AppConfig, names []string, tag string) ([]*exportedService, error) {
+	results := []*exportedService{}
+	for _, name := range names {
+		entries, _, err := cfg.client.Health().Service(name, tag, true, cfg.queryOpts)
+		if err != nil {
+			return results, err
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Node.Node != entries[j].Node.Node {
+				return entries[i].Node.Node < entries[j].Node.Node
+			}
+			return entries[i].Service.ID < entries[j].Service.ID
+		})
+		results = append(results, &exportedService{Name: name, Instances: entries})
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Name < results[j].Name })
+	return results, nil
+}
+
+// writeFileAtomic writes to a temp file in the same directory and renames
+// it over path so readers never see a partial file
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// exportName makes a string safe to use as an haproxy or nginx identifier
+func exportName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func renderHAProxy(services []*exportedService) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, s := range services {
+		fmt.Fprintf(buf, "backend %s\n", exportName(s.Name))
+		fmt.Fprintf(buf, "    balance roundrobin\n")
+		for _, e := range s.Instances {
+			fmt.Fprintf(buf, "    server %s %s:%d check\n",
+				exportName(e.Node.Node+"-"+e.Service.ID), serviceEntryAddress(e), e.Service.Port)
+		}
+		fmt.Fprintln(buf)
+	}
+	return buf.Bytes(), nil
+}
+
+func renderNginx(services []*exportedService) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	for _, s := range services {
+		fmt.Fprintf(buf, "upstream %s {\n", exportName(s.Name))
+		// nginx refuses to load an empty upstream block
+		if len(s.Instances) < 1 {
+			fmt.Fprintf(buf, "    server 127.0.0.1:65535 down;\n")
+		}
+		for _, e := range s.Instances {
+			fmt.Fprintf(buf, "    server %s:%d;\n", serviceEntryAddress(e), e.Service.Port)
+		}
+		fmt.Fprintf(buf, "}\n\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// renderEnvoyEDS renders a DiscoveryResponse for Envoy's file based EDS
+func renderEnvoyEDS(services []*exportedService) ([]byte, error) {
+	type socketAddress struct {
+		Address   string `json:"address"`
+		PortValue int    `json:"port_value"`
+	}
+	type lbEndpoint struct {
+		Endpoint struct {
+			Address struct {
+				SocketAddress socketAddress `json:"socket_address"`
+			} `json:"address"`
+		} `json:"endpoint"`
+	}
+	type localityEndpoints struct {
+		LbEndpoints []lbEndpoint `json:"lb_endpoints"`
+	}
+	type loadAssignment struct {
+		Type        string              `json:"@type"`
+		ClusterName string              `json:"cluster_name"`
+		Endpoints   []localityEndpoints `json:"endpoints"`
+	}
+
+	resources := []loadAssignment{}
+	for _, s := range services {
+		le := localityEndpoints{LbEndpoints: []lbEndpoint{}}
+		for _, e := range s.Instances {
+			ep := lbEndpoint{}
+			ep.Endpoint.Address.SocketAddress = socketAddress{
+				Address:   serviceEntryAddress(e),
+				PortValue: e.Service.Port,
+			}
+			le.LbEndpoints = append(le.LbEndpoints, ep)
+		}
+		resources = append(resources, loadAssignment{
+			Type:        "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment",
+			ClusterName: s.Name,
+			Endpoints:   []localityEndpoints{le},
+		})
+	}
+
+	out, err := json.MarshalIndent(map[string]interface{}{"resources": resources}, "", "  ")
+	return append(out, '\n'), err
+}
+
+// renderPrometheusSD renders a target list for Prometheus' file_sd_configs
+func renderPrometheusSD(services []*exportedService) ([]byte, error) {
+	type targetGroup struct {
+		Targets []string          `json:"targets"`
+		Labels  map[string]string `json:"labels"`
+	}
+
+	groups := []targetGroup{}
+	for _, s := range services {
+		for _, e := range s.Instances {
+			groups = append(groups, targetGroup{
+				Targets: []string{fmt.Sprintf("%s:%d", serviceEntryAddress(e), e.Service.Port)},
+				Labels: map[string]string{
+					"job":        s.Name,
+					"service":    s.Name,
+					"service_id": e.Service.ID,
+					"node":       e.Node.Node,
+					"datacenter": e.Node.Datacenter,
+				},
+			})
+		}
+	}
+
+	out, err := json.MarshalIndent(groups, "", "  ")
+	return append(out, '\n'), err
+}
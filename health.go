@@ -0,0 +1,166 @@
+package main
+
+import (
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"path/filepath"
+	"sort"
+)
+
+func HealthState(c *cli.Context) {
+	state := c.Args().First()
+	if len(state) < 1 {
+		state = api.HealthAny
+	}
+	switch state {
+	case api.HealthAny, api.HealthPassing, api.HealthWarning, api.HealthCritical:
+	default:
+		log.Errorf("Unknown state %q, must be passing, warning, critical or any", state)
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	checks, _, err := cfg.client.Health().State(state, cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Failed to load health state: %v", err)
+	}
+	printHealthChecks(c, checks)
+}
+
+func HealthNode(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("node name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	checks, _, err := cfg.client.Health().Node(c.Args().First(), cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Failed to load node health: %v", err)
+	}
+	printHealthChecks(c, checks)
+}
+
+func HealthService(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("service name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	checks, _, err := cfg.client.Health().Checks(c.Args().First(), cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Failed to load service health: %v", err)
+	}
+	printHealthChecks(c, checks)
+}
+
+// printHealthChecks applies the shared --status, --service and --node
+// filters, then prints the checks sorted or as a per-service summary
+func printHealthChecks(c *cli.Context, checks api.HealthChecks) {
+	filtered := filterHealthChecks(checks, c.String("status"), c.String("service"), c.String("node"))
+
+	sort.Slice(filtered, func(i, j int) bool {
+		if filtered[i].Node != filtered[j].Node {
+			return filtered[i].Node < filtered[j].Node
+		}
+		return filtered[i].CheckID < filtered[j].CheckID
+	})
+
+	if c.Bool("summary") {
+		summary := summarizeHealthChecks(filtered)
+		if c.GlobalBool("verbose") {
+			dumpJson(summary)
+			return
+		}
+		prettyPrintHealthSummary(summary)
+		return
+	}
+
+	if c.GlobalBool("verbose") {
+		dumpJson(filtered)
+		return
+	}
+	prettyPrintHealthChecks(filtered)
+}
+
+// filterHealthChecks keeps checks matching the status and the
+// service and node glob patterns. Empty filters match everything.
+func filterHealthChecks(checks api.HealthChecks, status, service, node string) api.HealthChecks {
+	results := api.HealthChecks{}
+	for _, hc := range checks {
+		if len(status) > 0 && status != api.HealthAny && hc.Status != status {
+			continue
+		}
+		if len(service) > 0 {
+			if ok, _ := filepath.Match(service, hc.ServiceName); !ok {
+				continue
+			}
+		}
+		if len(node) > 0 {
+			if ok, _ := filepath.Match(node, hc.Node); !ok {
+				continue
+			}
+		}
+		results = append(results, hc)
+	}
+	return results
+}
+
+// healthSummary counts checks per state for a single service
+type healthSummary struct {
+	Service  string
+	Passing  int
+	Warning  int
+	Critical int
+	Other    int
+}
+
+func summarizeHealthChecks(checks api.HealthChecks) []*healthSummary {
+	byService := map[string]*healthSummary{}
+	for _, hc := range checks {
+		// Node level checks like serfHealth have no service
+		name := hc.ServiceName
+		if len(name) < 1 {
+			name = "(node)"
+		}
+		s, ok := byService[name]
+		if !ok {
+			s = &healthSummary{Service: name}
+			byService[name] = s
+		}
+		switch hc.Status {
+		case api.HealthPassing:
+			s.Passing++
+		case api.HealthWarning:
+			s.Warning++
+		case api.HealthCritical:
+			s.Critical++
+		default:
+			s.Other++
+		}
+	}
+
+	results := []*healthSummary{}
+	for _, s := range byService {
+		results = append(results, s)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Service < results[j].Service })
+	return results
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"github.com/codegangsta/cli"
+	log "github.com/sirupsen/logrus"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// HeartbeatCheck keeps a TTL check alive by running a local probe on an
+// interval. Exit code 0 passes, 1 warns and anything else fails, the same
+// as Consul's script checks.
+func HeartbeatCheck(c *cli.Context) {
+	if len(c.Args().First()) < 1 || len(c.String("cmd")) < 1 {
+		log.Errorln("check ID and --cmd are required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+	id := c.Args().First()
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	agent := cfg.client.Agent()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+
+	ticker := time.NewTicker(c.Duration("every"))
+	defer ticker.Stop()
+
+	for {
+		status, output := runProbe(c.String("cmd"), c.Duration("timeout"), c.Int("max-output"))
+		if err := agent.UpdateTTL(id, output, status); err != nil {
+			log.Errorf("Could not update check: %v", err)
+		} else {
+			log.Debugf("Check %s is %s", id, status)
+		}
+
+		select {
+		case sig := <-sigs:
+			log.Infof("Received %v, marking %s critical", sig, id)
+			if err := agent.UpdateTTL(id, "consulctl heartbeat stopped", "fail"); err != nil {
+				log.Fatalf("Could not update check: %v", err)
+			}
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runProbe runs a shell command and maps its exit code to a TTL status
+// of pass, warn or fail. The combined output is truncated to maxOutput bytes.
+func runProbe(command string, timeout time.Duration, maxOutput int) (string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	buf := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdout = buf
+	cmd.Stderr = buf
+
+	// Killing only the shell would leave children like curl holding the
+	// output pipe and Run blocked past the timeout, so run the probe in its
+	// own process group and kill all of it. WaitDelay is the backstop for
+	// anything that escaped the group.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	cmd.WaitDelay = time.Second
+	err := cmd.Run()
+
+	output := buf.String()
+	if maxOutput > 0 && len(output) > maxOutput {
+		output = output[:maxOutput] + "\n... (truncated)"
+	}
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return "fail", "Timed out after " + timeout.String() + "\n" + output
+	}
+	if err == nil {
+		return "pass", output
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == 1 {
+		return "warn", output
+	}
+	if len(output) < 1 {
+		output = err.Error()
+	}
+	return "fail", output
+}
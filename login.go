@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// cachedToken is a token from login, kept until logout or expiry
+type cachedToken struct {
+	AuthMethod     string
+	AccessorID     string
+	SecretID       string
+	ExpirationTime *time.Time `json:",omitempty"`
+}
+
+// Expired is true once the token's expiration time has passed
+func (t *cachedToken) Expired() bool {
+	return t.ExpirationTime != nil && time.Now().After(*t.ExpirationTime)
+}
+
+func Login(c *cli.Context) {
+	if len(c.String("method")) < 1 || len(c.String("bearer-token-file")) < 1 {
+		log.Errorln("--method and --bearer-token-file are required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	var (
+		bearer []byte
+		err    error
+	)
+	if path := c.String("bearer-token-file"); path == "-" {
+		bearer, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		bearer, err = ioutil.ReadFile(path)
+	}
+	if err != nil {
+		log.Fatalf("Could not read bearer token: %v", err)
+	}
+
+	meta, err := parseKeyValues(c.StringSlice("meta"))
+	if err != nil {
+		log.Fatalf("Invalid meta: %v", err)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	t, _, err := cfg.client.ACL().Login(&api.ACLLoginParams{
+		AuthMethod:  c.String("method"),
+		BearerToken: strings.TrimSpace(string(bearer)),
+		Meta:        meta,
+	}, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not log in: %v", err)
+	}
+
+	if c.Bool("no-cache") {
+		printToken(c, t)
+		return
+	}
+
+	cache, err := loadTokenCache(c)
+	if err != nil {
+		log.Fatalf("Could not read token cache: %v", err)
+	}
+	cache[tokenCacheKey(c)] = &cachedToken{
+		AuthMethod:     t.AuthMethod,
+		AccessorID:     t.AccessorID,
+		SecretID:       t.SecretID,
+		ExpirationTime: t.ExpirationTime,
+	}
+	if err = saveTokenCache(c, cache); err != nil {
+		log.Fatalf("Could not write token cache: %v", err)
+	}
+	log.Infof("Logged in with %s as token %s", c.String("method"), t.AccessorID)
+}
+
+// Logout destroys the cached login token and removes it from the cache
+func Logout(c *cli.Context) {
+	cache, err := loadTokenCache(c)
+	if err != nil {
+		log.Fatalf("Could not read token cache: %v", err)
+	}
+	key := tokenCacheKey(c)
+	cached, ok := cache[key]
+	if !ok {
+		log.Fatalf("Not logged in to %s", key)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	// Expired tokens are already gone, there's nothing to destroy
+	if !cached.Expired() {
+		opts := *cfg.writeOpts
+		opts.Token = cached.SecretID
+		if _, err = cfg.client.ACL().Logout(&opts); err != nil {
+			log.Fatalf("Could not log out: %v", err)
+		}
+	}
+
+	delete(cache, key)
+	if err = saveTokenCache(c, cache); err != nil {
+		log.Fatalf("Could not write token cache: %v", err)
+	}
+	log.Println("Success")
+}
+
+// tokenCacheKey identifies a cluster in the cache, so logins to
+// several clusters or datacenters don't overwrite each other
+func tokenCacheKey(c *cli.Context) string {
+	return c.GlobalString("addr") + "/" + c.GlobalString("datacenter")
+}
+
+func tokenCachePath(c *cli.Context) string {
+	if path := c.GlobalString("token-cache"); len(path) > 0 {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".consulctl", "tokens.json")
+}
+
+func loadTokenCache(c *cli.Context) (map[string]*cachedToken, error) {
+	cache := map[string]*cachedToken{}
+	b, err := ioutil.ReadFile(tokenCachePath(c))
+	if os.IsNotExist(err) {
+		return cache, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return cache, json.Unmarshal(b, &cache)
+}
+
+func saveTokenCache(c *cli.Context, cache map[string]*cachedToken) error {
+	path := tokenCachePath(c)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(cache, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, b, 0600)
+}
+
+// cachedLoginToken returns the secret from a previous login to this
+// cluster, or an empty string if there isn't a usable one
+func cachedLoginToken(c *cli.Context) string {
+	cache, err := loadTokenCache(c)
+	if err != nil {
+		log.Warnf("Ignoring token cache: %v", err)
+		return ""
+	}
+	t, ok := cache[tokenCacheKey(c)]
+	if !ok {
+		return ""
+	}
+	if t.Expired() {
+		log.Warnf("Cached login token %s has expired, log in again", t.AccessorID)
+		return ""
+	}
+	return t.SecretID
+}
@@ -16,12 +16,18 @@ func main() {
 	app.Commands = []cli.Command{
 		ACLCommand,
 		BackupCommand,
+		CatalogCommand,
 		CheckCommand,
 		EventsCommand,
+		ExecCommand,
+		HealthCommand,
 		KvCommand,
+		LoginCommand,
+		LogoutCommand,
 		RestoreCommand,
 		AgentCommand,
 		ServiceCommand,
+		WaitForCommand,
 	}
 
 	app.Run(os.Args)
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+func CreatePolicy(c *cli.Context) {
+	if len(c.String("name")) < 1 {
+		log.Errorln("--name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	policy := &api.ACLPolicy{}
+	if !applyPolicyFlags(c, policy) {
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	p, _, err := cfg.client.ACL().PolicyCreate(policy, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create policy: %v", err)
+	}
+	printPolicy(c, p)
+}
+
+func ReadPolicy(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("policy ID or name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	p, err := readPolicy(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read policy: %v", err)
+	}
+	printPolicy(c, p)
+}
+
+func UpdatePolicy(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("policy ID or name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	policy, err := readPolicy(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read policy: %v", err)
+	}
+	if !applyPolicyFlags(c, policy) {
+		log.Exit(2)
+	}
+
+	p, _, err := cfg.client.ACL().PolicyUpdate(policy, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not update policy: %v", err)
+	}
+	printPolicy(c, p)
+}
+
+func DeletePolicy(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("policy ID or name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	p, err := readPolicy(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read policy: %v", err)
+	}
+	if _, err = cfg.client.ACL().PolicyDelete(p.ID, cfg.writeOpts); err != nil {
+		log.Fatalf("Could not delete policy: %v", err)
+	}
+	log.Println("Success")
+}
+
+func ListPolicies(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	policies, _, err := cfg.client.ACL().PolicyList(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list policies: %v", err)
+	}
+
+	if useJsonOutput(c) {
+		dumpJson(policies)
+		return
+	}
+	prettyPrintPolicyList(policies)
+}
+
+// readPolicy reads a policy by ID if the argument looks like one, else by name
+func readPolicy(cfg *AppConfig, idOrName string) (*api.ACLPolicy, error) {
+	var (
+		p   *api.ACLPolicy
+		err error
+	)
+	if uuidPattern.MatchString(idOrName) {
+		p, _, err = cfg.client.ACL().PolicyRead(idOrName, cfg.queryOpts)
+	} else {
+		p, _, err = cfg.client.ACL().PolicyReadByName(idOrName, cfg.queryOpts)
+	}
+	if err == nil && p == nil {
+		err = fmt.Errorf("policy %s not found", idOrName)
+	}
+	return p, err
+}
+
+// applyPolicyFlags copies the flags that were set onto the policy.
+// Returns false if the rules couldn't be loaded or failed linting.
+func applyPolicyFlags(c *cli.Context, policy *api.ACLPolicy) bool {
+	if c.IsSet("name") {
+		policy.Name = c.String("name")
+	}
+	if c.IsSet("description") {
+		policy.Description = c.String("description")
+	}
+	if c.IsSet("valid-datacenter") {
+		policy.Datacenters = c.StringSlice("valid-datacenter")
+	}
+
+	rules, set, err := aclRulesFromContext(c, "rules")
+	if err != nil {
+		log.Errorf("Could not load rules: %v", err)
+		return false
+	}
+	if set {
+		if !validateACLRules(c, rules) {
+			return false
+		}
+		policy.Rules = rules
+	}
+	return true
+}
+
+func printPolicy(c *cli.Context, p *api.ACLPolicy) {
+	if useJsonOutput(c) {
+		dumpJson(p)
+		return
+	}
+	prettyPrintPolicy(p)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// Standard Nagios/Sensu plugin exit codes
+const (
+	probeOK = iota
+	probeWarning
+	probeCritical
+	probeUnknown
+)
+
+var probeStatusNames = []string{"OK", "WARNING", "CRITICAL", "UNKNOWN"}
+
+// probeResult is the outcome of a single probe condition
+type probeResult struct {
+	status  int
+	message string
+	perf    []string
+}
+
+// ProbeHealth evaluates the requested conditions and exits with a
+// monitoring plugin status code and a single line of output with perfdata
+func ProbeHealth(c *cli.Context) {
+	results := []*probeResult{}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		exitProbe([]*probeResult{{status: probeUnknown, message: fmt.Sprintf("failed to get client: %v", err)}})
+	}
+
+	if len(c.String("service")) > 0 {
+		results = append(results, probeService(cfg, c.String("service"), c.String("tag"),
+			c.Int("warn-passing"), c.Int("min-passing")))
+	}
+	if len(c.String("node")) > 0 {
+		results = append(results, probeNode(cfg, c.String("node")))
+	}
+	if len(c.String("key")) > 0 {
+		results = append(results, probeKey(cfg, c.String("key"), c.String("key-match")))
+	}
+
+	if len(results) < 1 {
+		results = append(results, &probeResult{status: probeUnknown, message: "no conditions given, use --service, --node or --key"})
+	}
+	exitProbe(results)
+}
+
+// exitProbe prints the combined result and exits with the worst status
+func exitProbe(results []*probeResult) {
+	status := probeOK
+	messages := []string{}
+	perf := []string{}
+	for _, r := range results {
+		if r.status > status {
+			status = r.status
+		}
+		messages = append(messages, r.message)
+		perf = append(perf, r.perf...)
+	}
+
+	line := fmt.Sprintf("CONSUL %s - %s", probeStatusNames[status], strings.Join(messages, "; "))
+	if len(perf) > 0 {
+		line += " | " + strings.Join(perf, " ")
+	}
+	fmt.Println(line)
+	os.Exit(status)
+}
+
+func probeService(cfg *AppConfig, name, tag string, warn, crit int) *probeResult {
+	entries, _, err := cfg.client.Health().Service(name, tag, true, cfg.queryOpts)
+	if err != nil {
+		return &probeResult{status: probeUnknown, message: fmt.Sprintf("service %s: %v", name, err)}
+	}
+
+	passing := len(entries)
+	r := &probeResult{
+		status:  probeOK,
+		message: fmt.Sprintf("service %s has %d passing", name, passing),
+		// These are minimums, "N:" alerts below N where a bare N alerts above it
+		perf: []string{fmt.Sprintf("'%s_passing'=%d;%d:;%d:;0", name, passing, warn, crit)},
+	}
+	switch {
+	case passing < crit:
+		r.status = probeCritical
+		r.message += fmt.Sprintf(" (< %d)", crit)
+	case passing < warn:
+		r.status = probeWarning
+		r.message += fmt.Sprintf(" (< %d)", warn)
+	}
+	return r
+}
+
+func probeNode(cfg *AppConfig, node string) *probeResult {
+	checks, _, err := cfg.client.Health().Node(node, cfg.queryOpts)
+	if err != nil {
+		return &probeResult{status: probeUnknown, message: fmt.Sprintf("node %s: %v", node, err)}
+	}
+	if len(checks) < 1 {
+		return &probeResult{status: probeCritical, message: fmt.Sprintf("node %s has no checks", node)}
+	}
+
+	warning, critical := 0, 0
+	failing := []string{}
+	for _, hc := range checks {
+		switch hc.Status {
+		case api.HealthWarning:
+			warning++
+			failing = append(failing, hc.CheckID)
+		case api.HealthCritical, api.HealthMaint:
+			critical++
+			failing = append(failing, hc.CheckID)
+		}
+	}
+
+	r := &probeResult{
+		status:  probeOK,
+		message: fmt.Sprintf("node %s has %d critical, %d warning", node, critical, warning),
+		perf: []string{
+			// Any failing check alerts, a bare 0 means anything above 0
+			fmt.Sprintf("'%s_critical'=%d;;0;0", node, critical),
+			fmt.Sprintf("'%s_warning'=%d;0;;0", node, warning),
+		},
+	}
+	if critical > 0 {
+		r.status = probeCritical
+	} else if warning > 0 {
+		r.status = probeWarning
+	}
+	if len(failing) > 0 {
+		r.message += " (" + strings.Join(failing, ", ") + ")"
+	}
+	return r
+}
+
+func probeKey(cfg *AppConfig, key, match string) *probeResult {
+	key = strings.TrimPrefix(key, "/")
+	pair, _, err := cfg.client.KV().Get(key, cfg.queryOpts)
+	if err != nil {
+		return &probeResult{status: probeUnknown, message: fmt.Sprintf("key %s: %v", key, err)}
+	}
+	if pair == nil {
+		return &probeResult{status: probeCritical, message: fmt.Sprintf("key %s does not exist", key)}
+	}
+
+	if len(match) > 0 {
+		re, err := regexp.Compile(match)
+		if err != nil {
+			return &probeResult{status: probeUnknown, message: fmt.Sprintf("invalid --key-match: %v", err)}
+		}
+		if !re.Match(pair.Value) {
+			return &probeResult{status: probeCritical, message: fmt.Sprintf("key %s does not match %s", key, match)}
+		}
+	}
+	return &probeResult{status: probeOK, message: fmt.Sprintf("key %s exists", key)}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"math/rand"
+	"sort"
+	"strings"
+	"time"
+)
+
+// resolvedInstance is the JSON form of a healthy service instance
+type resolvedInstance struct {
+	Node       string            `json:"node"`
+	Datacenter string            `json:"datacenter"`
+	ID         string            `json:"id"`
+	Address    string            `json:"address"`
+	Port       int               `json:"port"`
+	Tags       []string          `json:"tags"`
+	Meta       map[string]string `json:"meta,omitempty"`
+}
+
+var resolveFormats = []string{"addr", "a", "srv", "url", "json"}
+
+func ResolveService(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("service name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+	if !stringArrayContains(c.String("format"), resolveFormats) {
+		log.Errorf("Unknown format %q, must be addr, a, srv, url or json", c.String("format"))
+		log.Exit(2)
+	}
+	order := c.String("order")
+	if order != "sorted" && order != "random" && order != "nearest" {
+		log.Errorf("Unknown order %q, must be sorted, random or nearest", order)
+		log.Exit(2)
+	}
+
+	// Accept name.tag the same way the DNS interface accepts tag.name
+	name, tag := c.Args().First(), ""
+	if split := strings.SplitN(name, ".", 2); len(split) > 1 {
+		name, tag = split[0], split[1]
+	}
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	opts := *cfg.queryOpts
+	if order == "nearest" {
+		// Consul sorts the results by estimated RTT to this node
+		opts.Near = c.String("near")
+	}
+
+	entries, _, err := cfg.client.Health().Service(name, tag, true, &opts)
+	if err != nil {
+		log.Fatalf("Failed to resolve service: %v", err)
+	}
+	if len(entries) < 1 {
+		// Scripts using $(... --one) must not carry on with an empty address
+		log.Fatalf("No healthy instances of %s", c.Args().First())
+	}
+
+	switch order {
+	case "sorted":
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Node.Node != entries[j].Node.Node {
+				return entries[i].Node.Node < entries[j].Node.Node
+			}
+			return entries[i].Service.ID < entries[j].Service.ID
+		})
+	case "random":
+		r := rand.New(rand.NewSource(time.Now().UnixNano()))
+		r.Shuffle(len(entries), func(i, j int) {
+			entries[i], entries[j] = entries[j], entries[i]
+		})
+	}
+
+	if c.Bool("one") {
+		entries = entries[:1]
+	}
+
+	switch c.String("format") {
+	case "addr":
+		for _, e := range entries {
+			fmt.Printf("%s:%d\n", serviceEntryAddress(e), e.Service.Port)
+		}
+	case "a":
+		for _, e := range entries {
+			fmt.Println(serviceEntryAddress(e))
+		}
+	case "srv":
+		printSRVRecords(name, entries)
+	case "url":
+		for _, e := range entries {
+			fmt.Printf("%s://%s:%d\n", c.String("scheme"), serviceEntryAddress(e), e.Service.Port)
+		}
+	case "json":
+		results := []*resolvedInstance{}
+		for _, e := range entries {
+			results = append(results, &resolvedInstance{
+				Node:       e.Node.Node,
+				Datacenter: e.Node.Datacenter,
+				ID:         e.Service.ID,
+				Address:    serviceEntryAddress(e),
+				Port:       e.Service.Port,
+				Tags:       e.Service.Tags,
+				Meta:       e.Service.Meta,
+			})
+		}
+		dumpJson(results)
+	}
+}
+
+// printSRVRecords prints entries the way dig prints the answer
+// section of a Consul SRV query
+func printSRVRecords(name string, entries []*api.ServiceEntry) {
+	w := getTabwriter()
+	for _, e := range entries {
+		weight := e.Service.Weights.Passing
+		if weight < 1 {
+			weight = 1
+		}
+		fmt.Fprintf(w, "%s.service.consul.\t0\tIN\tSRV\t1 %d %d %s.node.%s.consul.\n",
+			name, weight, e.Service.Port, e.Node.Node, e.Node.Datacenter)
+	}
+	for _, e := range entries {
+		fmt.Fprintf(w, "%s.node.%s.consul.\t0\tIN\tA\t%s\n",
+			e.Node.Node, e.Node.Datacenter, serviceEntryAddress(e))
+	}
+	w.Flush()
+}
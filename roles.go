@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+)
+
+func CreateRole(c *cli.Context) {
+	if len(c.String("name")) < 1 {
+		log.Errorln("--name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	role := &api.ACLRole{}
+	if err := applyRoleFlags(c, role); err != nil {
+		log.Errorf("Invalid role: %v", err)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	r, _, err := cfg.client.ACL().RoleCreate(role, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create role: %v", err)
+	}
+	printRole(c, r)
+}
+
+func ReadRole(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("role ID or name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	r, err := readRole(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read role: %v", err)
+	}
+	printRole(c, r)
+}
+
+func UpdateRole(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("role ID or name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	role, err := readRole(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read role: %v", err)
+	}
+	if err = applyRoleFlags(c, role); err != nil {
+		log.Fatalf("Invalid role: %v", err)
+	}
+
+	r, _, err := cfg.client.ACL().RoleUpdate(role, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not update role: %v", err)
+	}
+	printRole(c, r)
+}
+
+func DeleteRole(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("role ID or name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	r, err := readRole(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read role: %v", err)
+	}
+	if _, err = cfg.client.ACL().RoleDelete(r.ID, cfg.writeOpts); err != nil {
+		log.Fatalf("Could not delete role: %v", err)
+	}
+	log.Println("Success")
+}
+
+func ListRoles(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	roles, _, err := cfg.client.ACL().RoleList(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list roles: %v", err)
+	}
+
+	if useJsonOutput(c) {
+		dumpJson(roles)
+		return
+	}
+	prettyPrintRoleList(roles)
+}
+
+// readRole reads a role by ID if the argument looks like one, else by name
+func readRole(cfg *AppConfig, idOrName string) (*api.ACLRole, error) {
+	var (
+		r   *api.ACLRole
+		err error
+	)
+	if uuidPattern.MatchString(idOrName) {
+		r, _, err = cfg.client.ACL().RoleRead(idOrName, cfg.queryOpts)
+	} else {
+		r, _, err = cfg.client.ACL().RoleReadByName(idOrName, cfg.queryOpts)
+	}
+	if err == nil && r == nil {
+		err = fmt.Errorf("role %s not found", idOrName)
+	}
+	return r, err
+}
+
+// applyRoleFlags copies the flags that were set onto the role
+func applyRoleFlags(c *cli.Context, role *api.ACLRole) error {
+	if c.IsSet("name") {
+		role.Name = c.String("name")
+	}
+	if c.IsSet("description") {
+		role.Description = c.String("description")
+	}
+	if c.IsSet("policy") {
+		role.Policies = aclLinks(c.StringSlice("policy"))
+	}
+	if c.IsSet("service-identity") {
+		ids, err := parseServiceIdentities(c.StringSlice("service-identity"))
+		if err != nil {
+			return err
+		}
+		role.ServiceIdentities = ids
+	}
+	if c.IsSet("node-identity") {
+		ids, err := parseNodeIdentities(c.StringSlice("node-identity"), c.GlobalString("datacenter"))
+		if err != nil {
+			return err
+		}
+		role.NodeIdentities = ids
+	}
+	return nil
+}
+
+func printRole(c *cli.Context, r *api.ACLRole) {
+	if useJsonOutput(c) {
+		dumpJson(r)
+		return
+	}
+	prettyPrintRole(r)
+}
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// runnerConfig is the checks file read by check runner. JSON works too.
+type runnerConfig struct {
+	Concurrency int               `yaml:"concurrency"`
+	Checks      []*runnerCheckDef `yaml:"checks"`
+}
+
+// runnerCheckDef is one locally executed check. Exactly one of
+// command, http or tcp must be set.
+type runnerCheckDef struct {
+	ID        string `yaml:"id"`
+	Name      string `yaml:"name"`
+	ServiceID string `yaml:"service_id"`
+	Notes     string `yaml:"notes"`
+	Interval  string `yaml:"interval"`
+	Timeout   string `yaml:"timeout"`
+	TTL       string `yaml:"ttl"`
+	Command   string `yaml:"command"`
+	HTTP      string `yaml:"http"`
+	TCP       string `yaml:"tcp"`
+
+	interval time.Duration
+	timeout  time.Duration
+	ttl      time.Duration
+}
+
+// RunChecks registers TTL checks for every entry in the checks file, runs
+// the probes locally and pushes the results to the agent. The checks are
+// deregistered again on SIGINT or SIGTERM.
+func RunChecks(c *cli.Context) {
+	if len(c.String("file")) < 1 {
+		log.Errorln("--file is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	conf, err := loadRunnerConfig(c.String("file"))
+	if err != nil {
+		log.Fatalf("Could not load checks: %v", err)
+	}
+	if c.IsSet("concurrency") || conf.Concurrency < 1 {
+		conf.Concurrency = c.Int("concurrency")
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	agent := cfg.client.Agent()
+
+	registered := []string{}
+	deregister := func() {
+		for _, id := range registered {
+			if err := agent.CheckDeregister(id); err != nil {
+				log.Errorf("Could not deregister check %s: %v", id, err)
+			}
+		}
+	}
+
+	for _, def := range conf.Checks {
+		err := agent.CheckRegister(&api.AgentCheckRegistration{
+			ID:        def.ID,
+			Name:      def.Name,
+			ServiceID: def.ServiceID,
+			Notes:     def.Notes,
+			AgentServiceCheck: api.AgentServiceCheck{
+				TTL: def.ttl.String(),
+			},
+		})
+		if err != nil {
+			deregister()
+			log.Fatalf("Error registering check %s: %v", def.ID, err)
+		}
+		registered = append(registered, def.ID)
+		log.Infof("Registered TTL check %s", def.ID)
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	stop := make(chan struct{})
+	slots := make(chan struct{}, conf.Concurrency)
+	jitter := c.Float64("jitter")
+	wg := &sync.WaitGroup{}
+
+	for _, def := range conf.Checks {
+		wg.Add(1)
+		go func(def *runnerCheckDef) {
+			defer wg.Done()
+
+			// Spread the first runs over an interval so checks don't all fire at once
+			delay := time.Duration(rand.Int63n(int64(def.interval)))
+			for {
+				select {
+				case <-stop:
+					return
+				case <-time.After(delay):
+				}
+
+				slots <- struct{}{}
+				status, output := runRunnerCheck(def)
+				<-slots
+
+				if err := agent.UpdateTTL(def.ID, output, status); err != nil {
+					log.Errorf("Could not update check %s: %v", def.ID, err)
+				} else {
+					log.Debugf("Check %s is %s", def.ID, status)
+				}
+
+				delay = def.interval
+				if jitter > 0 {
+					delay += time.Duration(rand.Float64() * jitter * float64(def.interval))
+				}
+			}
+		}(def)
+	}
+
+	sig := <-sigs
+	log.Infof("Received %v, deregistering checks", sig)
+	close(stop)
+	wg.Wait()
+	deregister()
+}
+
+func loadRunnerConfig(path string) (*runnerConfig, error) {
+	fileBytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	conf := &runnerConfig{}
+	if err = yaml.Unmarshal(fileBytes, conf); err != nil {
+		return nil, err
+	}
+	if len(conf.Checks) < 1 {
+		return nil, fmt.Errorf("%s has no checks", path)
+	}
+
+	ids := map[string]bool{}
+	for i, def := range conf.Checks {
+		if len(def.Name) < 1 {
+			return nil, fmt.Errorf("check %d has no name", i+1)
+		}
+		if len(def.ID) < 1 {
+			def.ID = def.Name
+		}
+		if ids[def.ID] {
+			return nil, fmt.Errorf("duplicate check ID %s", def.ID)
+		}
+		ids[def.ID] = true
+
+		probes := 0
+		for _, p := range []string{def.Command, def.HTTP, def.TCP} {
+			if len(p) > 0 {
+				probes++
+			}
+		}
+		if probes != 1 {
+			return nil, fmt.Errorf("check %s needs exactly one of command, http or tcp", def.ID)
+		}
+
+		if def.interval, err = parseRunnerDuration(def.Interval, 10*time.Second); err != nil {
+			return nil, fmt.Errorf("check %s: invalid interval: %v", def.ID, err)
+		}
+		if def.timeout, err = parseRunnerDuration(def.Timeout, 5*time.Second); err != nil {
+			return nil, fmt.Errorf("check %s: invalid timeout: %v", def.ID, err)
+		}
+		// Leave room for a missed run and jitter before the agent gives up
+		if def.ttl, err = parseRunnerDuration(def.TTL, 3*def.interval); err != nil {
+			return nil, fmt.Errorf("check %s: invalid ttl: %v", def.ID, err)
+		}
+	}
+	return conf, nil
+}
+
+func parseRunnerDuration(s string, def time.Duration) (time.Duration, error) {
+	if len(s) < 1 {
+		return def, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err == nil && d <= 0 {
+		err = fmt.Errorf("must be positive")
+	}
+	return d, err
+}
+
+// runRunnerCheck runs a single probe and returns a TTL status and output
+func runRunnerCheck(def *runnerCheckDef) (string, string) {
+	switch {
+	case len(def.Command) > 0:
+		return runProbe(def.Command, def.timeout, 4096)
+	case len(def.HTTP) > 0:
+		return runHTTPProbe(def.HTTP, def.timeout)
+	default:
+		return runTCPProbe(def.TCP, def.timeout)
+	}
+}
+
+// runHTTPProbe follows Consul's HTTP check rules: 2xx passes,
+// 429 warns and anything else fails
+func runHTTPProbe(url string, timeout time.Duration) (string, string) {
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "fail", err.Error()
+	}
+	defer resp.Body.Close()
+
+	output := fmt.Sprintf("HTTP GET %s: %s", url, resp.Status)
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return "pass", output
+	case resp.StatusCode == http.StatusTooManyRequests:
+		return "warn", output
+	}
+	return "fail", output
+}
+
+func runTCPProbe(addr string, timeout time.Duration) (string, string) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return "fail", err.Error()
+	}
+	conn.Close()
+	return "pass", fmt.Sprintf("TCP connect %s: Success", addr)
+}
@@ -15,6 +15,11 @@ func ServiceMaint(c *cli.Context) {
 		log.Errorf("Failed to get client: %v", err)
 		return
 	}
+	if len(c.Args().Tail()) < 1 {
+		log.Errorln("service ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
 	action := c.Args().First()
 	service := c.Args().Tail()[0]
 	reason := ""
@@ -143,6 +148,14 @@ func ListServices(c *cli.Context) {
 	prettyPrintServices(services)
 }
 
+// serviceEntryAddress returns the service address, falling back to the node's
+func serviceEntryAddress(e *api.ServiceEntry) string {
+	if len(e.Service.Address) > 0 {
+		return e.Service.Address
+	}
+	return e.Node.Address
+}
+
 func parseCatalogServices(catalog *api.Catalog, qOpts *api.QueryOptions) ([]*api.CatalogService, error) {
 	results := []*api.CatalogService{}
 	svcs, _, err := catalog.Services(&api.QueryOptions{})
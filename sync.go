@@ -0,0 +1,361 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+type syncAction struct {
+	Op      string
+	ID      string
+	Details string
+	reg     *api.AgentServiceRegistration
+}
+
+func SyncServices(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("service definition directory is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	desired, err := loadServiceDefinitions(c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not load service definitions: %v", err)
+	}
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	agent := cfg.client.Agent()
+
+	current, err := agent.Services()
+	if err != nil {
+		log.Fatalf("Failed to list agent services: %v", err)
+	}
+	checks, err := agent.Checks()
+	if err != nil {
+		log.Fatalf("Failed to list agent checks: %v", err)
+	}
+
+	plan := planServiceSync(desired, current, checks, c.StringSlice("keep"))
+	if len(plan) < 1 {
+		log.Println("Services are up to date")
+		return
+	}
+
+	w := getTabwriter()
+	for _, a := range plan {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", a.Op, a.ID, a.Details)
+	}
+	w.Flush()
+
+	if c.Bool("dry-run") {
+		return
+	}
+
+	failed := 0
+	for _, a := range plan {
+		if a.Op == "-" {
+			err = agent.ServiceDeregister(a.ID)
+		} else {
+			err = agent.ServiceRegister(a.reg)
+		}
+		if err != nil {
+			log.Errorf("Could not sync %s: %v", a.ID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		log.Fatalf("%d of %d changes failed", failed, len(plan))
+	}
+	log.Println("Success")
+}
+
+// loadServiceDefinitions reads every .json file in dir, keyed by service ID
+func loadServiceDefinitions(dir string) (map[string]*api.AgentServiceRegistration, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	results := map[string]*api.AgentServiceRegistration{}
+	for _, f := range files {
+		fileBytes, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		regs, err := parseServiceDefinitions(fileBytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", f, err)
+		}
+
+		for _, reg := range regs {
+			if len(reg.Name) < 1 {
+				return nil, fmt.Errorf("%s: service has no name", f)
+			}
+			if len(reg.ID) < 1 {
+				reg.ID = reg.Name
+			}
+			if _, ok := results[reg.ID]; ok {
+				return nil, fmt.Errorf("%s: duplicate service ID %s", f, reg.ID)
+			}
+			results[reg.ID] = reg
+		}
+	}
+	return results, nil
+}
+
+// parseServiceDefinitions accepts the same layouts as Consul's own config
+// directory: a bare definition, {"service": {...}} or {"services": [...]},
+// with Consul's snake_case keys or api field names
+func parseServiceDefinitions(data []byte) ([]*api.AgentServiceRegistration, error) {
+	def := map[string]interface{}{}
+	if err := json.Unmarshal(data, &def); err != nil {
+		return nil, err
+	}
+
+	var defs []interface{}
+	wrappers := 0
+	for k, v := range def {
+		switch strings.ToLower(k) {
+		case "service":
+			defs = append(defs, v)
+		case "services":
+			list, ok := v.([]interface{})
+			if !ok {
+				return nil, fmt.Errorf("services must be a list")
+			}
+			defs = append(defs, list...)
+		default:
+			continue
+		}
+		wrappers++
+	}
+	switch {
+	case wrappers < 1:
+		defs = append(defs, def)
+	case wrappers != len(def):
+		return nil, fmt.Errorf("service or services must be the only key")
+	}
+
+	regs := []*api.AgentServiceRegistration{}
+	for _, d := range defs {
+		reg := &api.AgentServiceRegistration{}
+		if err := decodeConsulDefinition(d, reg); err != nil {
+			return nil, err
+		}
+		regs = append(regs, reg)
+	}
+	return regs, nil
+}
+
+// planServiceSync compares the desired definitions with the agent's services
+// and their checks. Services matching a keep pattern and Consul's own service
+// are never removed.
+func planServiceSync(desired map[string]*api.AgentServiceRegistration, current map[string]*api.AgentService,
+	checks map[string]*api.AgentCheck, keep []string) []*syncAction {
+	plan := []*syncAction{}
+
+	for id, reg := range desired {
+		svc, ok := current[id]
+		if !ok {
+			plan = append(plan, &syncAction{Op: "+", ID: id, Details: reg.Name, reg: reg})
+			continue
+		}
+		diff := diffServiceRegistration(reg, svc)
+		diff = append(diff, diffServiceChecks(reg, checks)...)
+		if len(diff) > 0 {
+			plan = append(plan, &syncAction{Op: "~", ID: id, Details: strings.Join(diff, ", "), reg: reg})
+		}
+	}
+
+	for id, svc := range current {
+		if _, ok := desired[id]; ok || svc.Service == "consul" {
+			continue
+		}
+		kept := false
+		for _, pattern := range keep {
+			if ok, _ := filepath.Match(pattern, id); ok {
+				kept = true
+				break
+			}
+		}
+		if !kept {
+			plan = append(plan, &syncAction{Op: "-", ID: id, Details: svc.Service})
+		}
+	}
+
+	sort.Slice(plan, func(i, j int) bool { return plan[i].ID < plan[j].ID })
+	return plan
+}
+
+// diffServiceRegistration lists the fields that differ between a
+// definition and what the agent currently has registered
+func diffServiceRegistration(reg *api.AgentServiceRegistration, svc *api.AgentService) []string {
+	return diffAgentServices(&api.AgentService{
+		Service:           reg.Name,
+		Address:           reg.Address,
+		Port:              reg.Port,
+		Tags:              reg.Tags,
+		Meta:              reg.Meta,
+		EnableTagOverride: reg.EnableTagOverride,
+	}, svc)
+}
+
+// diffServiceChecks lists the differences between a definition's checks and
+// the agent's. Script arguments and headers aren't reported by the agent so
+// changes to them can't be detected.
+func diffServiceChecks(reg *api.AgentServiceRegistration, checks map[string]*api.AgentCheck) []string {
+	want := reg.Checks
+	if reg.Check != nil {
+		want = append(api.AgentServiceChecks{reg.Check}, want...)
+	}
+
+	diff := []string{}
+	wantIDs := map[string]bool{}
+	for i, w := range want {
+		id := serviceCheckID(reg.ID, w, i, len(want))
+		wantIDs[id] = true
+		have, ok := checks[id]
+		if !ok || have.ServiceID != reg.ID {
+			diff = append(diff, "check "+id+" added")
+			continue
+		}
+
+		changed := []string{}
+		if t := serviceCheckType(w); len(have.Type) > 0 && t != have.Type {
+			changed = append(changed, "type")
+		}
+		if len(w.Name) > 0 && w.Name != have.Name {
+			changed = append(changed, "name")
+		}
+		def := have.Definition
+		if w.HTTP != def.HTTP || w.TCP != def.TCP || (len(w.Method) > 0 && w.Method != def.Method) {
+			changed = append(changed, "target")
+		}
+		if w.TLSSkipVerify != def.TLSSkipVerify {
+			changed = append(changed, "tls_skip_verify")
+		}
+		if !durationMatches(w.Interval, def.IntervalDuration) {
+			changed = append(changed, "interval")
+		}
+		if !durationMatches(w.Timeout, def.TimeoutDuration) {
+			changed = append(changed, "timeout")
+		}
+		if !durationMatches(w.DeregisterCriticalServiceAfter, def.DeregisterCriticalServiceAfterDuration) {
+			changed = append(changed, "deregister_critical_service_after")
+		}
+		if len(changed) > 0 {
+			diff = append(diff, fmt.Sprintf("check %s %s", id, strings.Join(changed, ", ")))
+		}
+	}
+
+	ids := []string{}
+	for id, have := range checks {
+		if have.ServiceID == reg.ID && !wantIDs[id] {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		diff = append(diff, "check "+id+" removed")
+	}
+	return diff
+}
+
+// serviceCheckID returns the ID the agent gives a service's check
+func serviceCheckID(serviceID string, check *api.AgentServiceCheck, i, total int) string {
+	if len(check.CheckID) > 0 {
+		return check.CheckID
+	}
+	if total > 1 {
+		return fmt.Sprintf("service:%s:%d", serviceID, i+1)
+	}
+	return "service:" + serviceID
+}
+
+// serviceCheckType returns the type the agent reports for a check definition
+func serviceCheckType(check *api.AgentServiceCheck) string {
+	switch {
+	case len(check.HTTP) > 0:
+		return "http"
+	case len(check.TCP) > 0:
+		return "tcp"
+	case len(check.GRPC) > 0:
+		return "grpc"
+	case len(check.DockerContainerID) > 0:
+		return "docker"
+	case len(check.Args) > 0:
+		return "script"
+	case len(check.AliasService) > 0 || len(check.AliasNode) > 0:
+		return "alias"
+	case len(check.TTL) > 0:
+		return "ttl"
+	}
+	return ""
+}
+
+// durationMatches compares a duration from a definition file with one
+// reported by the agent, an unparseable or empty value matches zero
+func durationMatches(want string, have time.Duration) bool {
+	d, _ := time.ParseDuration(want)
+	return d == have
+}
+
+// diffAgentServices lists the fields that differ between the wanted
+// and actual versions of a service
+func diffAgentServices(want, have *api.AgentService) []string {
+	diff := []string{}
+	if want.Service != have.Service {
+		diff = append(diff, fmt.Sprintf("name %s -> %s", have.Service, want.Service))
+	}
+	if want.Address != have.Address {
+		diff = append(diff, fmt.Sprintf("address %q -> %q", have.Address, want.Address))
+	}
+	if want.Port != have.Port {
+		diff = append(diff, fmt.Sprintf("port %d -> %d", have.Port, want.Port))
+	}
+	// With tag override the catalog owns the tags, anti-entropy copies
+	// them back to the agent, so differences there aren't drift
+	if !want.EnableTagOverride && !stringSetsEqual(want.Tags, have.Tags) {
+		diff = append(diff, fmt.Sprintf("tags %v -> %v", have.Tags, want.Tags))
+	}
+	if (len(want.Meta) > 0 || len(have.Meta) > 0) && !reflect.DeepEqual(want.Meta, have.Meta) {
+		diff = append(diff, fmt.Sprintf("meta %v -> %v", have.Meta, want.Meta))
+	}
+	if want.EnableTagOverride != have.EnableTagOverride {
+		diff = append(diff, fmt.Sprintf("enable_tag_override %v -> %v", have.EnableTagOverride, want.EnableTagOverride))
+	}
+	return diff
+}
+
+// stringSetsEqual compares two string lists ignoring order
+func stringSetsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, s := range a {
+		if !stringArrayContains(s, b) {
+			return false
+		}
+	}
+	for _, s := range b {
+		if !stringArrayContains(s, a) {
+			return false
+		}
+	}
+	return true
+}
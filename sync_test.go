@@ -0,0 +1,256 @@
+package main
+
+import (
+	"fmt"
+	"github.com/hashicorp/consul/api"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseServiceDefinitions(t *testing.T) {
+	cases := []struct {
+		name string
+		data string
+		want []string
+		err  bool
+	}{
+		{
+			name: "bare",
+			data: `{"id": "web-1", "name": "web", "port": 80}`,
+			want: []string{"web-1 web 80"},
+		},
+		{
+			name: "api field names",
+			data: `{"ID": "web-1", "Name": "web", "Port": 80}`,
+			want: []string{"web-1 web 80"},
+		},
+		{
+			name: "service wrapper",
+			data: `{"service": {"name": "web", "port": 80, "enable_tag_override": true}}`,
+			want: []string{" web 80"},
+		},
+		{
+			name: "services wrapper",
+			data: `{"services": [{"name": "web", "port": 80}, {"name": "db", "port": 5432}]}`,
+			want: []string{" web 80", " db 5432"},
+		},
+		{
+			name: "services not a list",
+			data: `{"services": {"name": "web"}}`,
+			err:  true,
+		},
+		{
+			name: "wrapper with other keys",
+			data: `{"service": {"name": "web"}, "port": 80}`,
+			err:  true,
+		},
+		{
+			name: "unknown key",
+			data: `{"name": "web", "prot": 80}`,
+			err:  true,
+		},
+		{
+			name: "invalid json",
+			data: `{"name": "web"`,
+			err:  true,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			regs, err := parseServiceDefinitions([]byte(tc.data))
+			if tc.err {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			got := []string{}
+			for _, reg := range regs {
+				got = append(got, fmt.Sprintf("%s %s %d", reg.ID, reg.Name, reg.Port))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("services = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestPlanServiceSync(t *testing.T) {
+	web := func(port int, checks ...*api.AgentServiceCheck) *api.AgentServiceRegistration {
+		return &api.AgentServiceRegistration{ID: "web", Name: "web", Port: port, Tags: []string{"v1"}, Checks: checks}
+	}
+	httpCheck := func(interval string) *api.AgentServiceCheck {
+		return &api.AgentServiceCheck{HTTP: "http://localhost/health", Interval: interval}
+	}
+	agentCheck := func(id string, interval time.Duration) *api.AgentCheck {
+		return &api.AgentCheck{
+			CheckID:   id,
+			ServiceID: "web",
+			Type:      "http",
+			Definition: api.HealthCheckDefinition{
+				HTTP:             "http://localhost/health",
+				IntervalDuration: interval,
+			},
+		}
+	}
+	current := map[string]*api.AgentService{
+		"web": {ID: "web", Service: "web", Port: 80, Tags: []string{"v1"}},
+	}
+
+	cases := []struct {
+		name    string
+		desired map[string]*api.AgentServiceRegistration
+		current map[string]*api.AgentService
+		checks  map[string]*api.AgentCheck
+		keep    []string
+		want    []string
+	}{
+		{
+			name:    "add",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(80)},
+			want:    []string{"+ web web"},
+		},
+		{
+			name:    "unchanged",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(80)},
+			current: current,
+			want:    []string{},
+		},
+		{
+			name:    "changed",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(8080)},
+			current: current,
+			want:    []string{"~ web port 80 -> 8080"},
+		},
+		{
+			name:    "remove unless kept",
+			desired: map[string]*api.AgentServiceRegistration{},
+			current: map[string]*api.AgentService{
+				"consul":   {ID: "consul", Service: "consul"},
+				"legacy-1": {ID: "legacy-1", Service: "legacy"},
+				"web":      {ID: "web", Service: "web"},
+			},
+			keep: []string{"legacy-*"},
+			want: []string{"- web web"},
+		},
+		{
+			name:    "check unchanged",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(80, httpCheck("10s"))},
+			current: current,
+			checks:  map[string]*api.AgentCheck{"service:web": agentCheck("service:web", 10*time.Second)},
+			want:    []string{},
+		},
+		{
+			name:    "check changed",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(80, httpCheck("30s"))},
+			current: current,
+			checks:  map[string]*api.AgentCheck{"service:web": agentCheck("service:web", 10*time.Second)},
+			want:    []string{"~ web check service:web interval"},
+		},
+		{
+			name:    "check added",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(80, httpCheck("10s"), httpCheck("10s"))},
+			current: current,
+			checks:  map[string]*api.AgentCheck{"service:web:1": agentCheck("service:web:1", 10*time.Second)},
+			want:    []string{"~ web check service:web:2 added"},
+		},
+		{
+			name:    "check removed",
+			desired: map[string]*api.AgentServiceRegistration{"web": web(80)},
+			current: current,
+			checks: map[string]*api.AgentCheck{
+				"service:web": agentCheck("service:web", 10*time.Second),
+				"node-check":  {CheckID: "node-check"},
+			},
+			want: []string{"~ web check service:web removed"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := []string{}
+			for _, a := range planServiceSync(tc.desired, tc.current, tc.checks, tc.keep) {
+				got = append(got, fmt.Sprintf("%s %s %s", a.Op, a.ID, a.Details))
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("plan = %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDiffAgentServices(t *testing.T) {
+	base := func() *api.AgentService {
+		return &api.AgentService{
+			Service: "web",
+			Address: "10.0.0.1",
+			Port:    80,
+			Tags:    []string{"a", "b"},
+			Meta:    map[string]string{"version": "1"},
+		}
+	}
+
+	cases := []struct {
+		name string
+		want func(*api.AgentService)
+		have func(*api.AgentService)
+		diff []string
+	}{
+		{
+			name: "same",
+			diff: []string{},
+		},
+		{
+			name: "tag order is ignored",
+			have: func(s *api.AgentService) { s.Tags = []string{"b", "a"} },
+			diff: []string{},
+		},
+		{
+			name: "empty and nil meta match",
+			want: func(s *api.AgentService) { s.Meta = nil },
+			have: func(s *api.AgentService) { s.Meta = map[string]string{} },
+			diff: []string{},
+		},
+		{
+			name: "fields",
+			want: func(s *api.AgentService) { s.Service, s.Address, s.Port = "api", "10.0.0.2", 8080 },
+			diff: []string{`name web -> api`, `address "10.0.0.1" -> "10.0.0.2"`, `port 80 -> 8080`},
+		},
+		{
+			name: "tags and meta",
+			want: func(s *api.AgentService) { s.Tags, s.Meta = []string{"a"}, map[string]string{"version": "2"} },
+			diff: []string{`tags [a b] -> [a]`, `meta map[version:1] -> map[version:2]`},
+		},
+		{
+			name: "tag override ignores tags",
+			want: func(s *api.AgentService) { s.EnableTagOverride = true },
+			have: func(s *api.AgentService) { s.EnableTagOverride, s.Tags = true, []string{"canary"} },
+			diff: []string{},
+		},
+		{
+			name: "tag override changed",
+			want: func(s *api.AgentService) { s.EnableTagOverride = true },
+			diff: []string{`enable_tag_override false -> true`},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			want, have := base(), base()
+			if tc.want != nil {
+				tc.want(want)
+			}
+			if tc.have != nil {
+				tc.have(have)
+			}
+			if got := diffAgentServices(want, have); !reflect.DeepEqual(got, tc.diff) {
+				t.Errorf("diff = %q, want %q", got, tc.diff)
+			}
+		})
+	}
+}
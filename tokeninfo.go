@@ -0,0 +1,266 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// effectivePolicy is a policy granted to a token, directly or through a role
+type effectivePolicy struct {
+	Policy *api.ACLPolicy
+	Via    string
+}
+
+// tokenInfo is everything that decides what a token can do
+type tokenInfo struct {
+	Token             *api.ACLToken
+	Roles             []*api.ACLRole
+	Policies          []*effectivePolicy
+	ServiceIdentities []*api.ACLServiceIdentity
+	NodeIdentities    []*api.ACLNodeIdentity
+}
+
+func TokenInfo(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("accessor ID or 'self' is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	info, err := readTokenInfo(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read token: %v", err)
+	}
+	printTokenInfo(c, info)
+}
+
+// WhoAmI describes the token requests are made with, from --token or login
+func WhoAmI(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+	if len(cfg.queryOpts.Token) < 1 {
+		log.Errorln("--token or a login is required, without one requests use the agent's default token")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	info, err := readTokenInfo(cfg, "self")
+	if err != nil {
+		log.Fatalf("Could not read token: %v", err)
+	}
+	printTokenInfo(c, info)
+}
+
+// RotateToken replaces a token with a new one granting the same access.
+// The new secret is handed out before the old token is deleted so
+// clients have the grace period to pick it up.
+func RotateToken(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("accessor ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	old, err := readToken(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read token: %v", err)
+	}
+
+	replacement := &api.ACLToken{
+		Description:       old.Description,
+		Policies:          old.Policies,
+		Roles:             old.Roles,
+		ServiceIdentities: old.ServiceIdentities,
+		NodeIdentities:    old.NodeIdentities,
+		Local:             old.Local,
+	}
+	if old.ExpirationTime != nil {
+		// Keep the lifetime, not the deadline, otherwise rotation gains nothing
+		replacement.ExpirationTTL = old.ExpirationTime.Sub(old.CreateTime)
+	}
+	if c.IsSet("description") {
+		replacement.Description = c.String("description")
+	}
+
+	t, _, err := cfg.client.ACL().TokenCreate(replacement, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create replacement token: %v", err)
+	}
+	log.Infof("Created token %s to replace %s", t.AccessorID, old.AccessorID)
+
+	stored := false
+	if key := c.String("kv"); len(key) > 0 {
+		_, err = cfg.client.KV().Put(&api.KVPair{Key: key, Value: []byte(t.SecretID)}, cfg.writeOpts)
+		if err != nil {
+			printToken(c, t)
+			log.Fatalf("Could not write secret to %s, old token kept: %v", key, err)
+		}
+		log.Infof("Secret written to key %s", key)
+		stored = true
+	}
+	if path := c.String("outfile"); len(path) > 0 {
+		if err = writeFileAtomic(path, []byte(t.SecretID+"\n"), 0600); err != nil {
+			printToken(c, t)
+			log.Fatalf("Could not write secret to %s, old token kept: %v", path, err)
+		}
+		log.Infof("Secret written to %s", path)
+		stored = true
+	}
+	if !stored {
+		printToken(c, t)
+	}
+
+	if c.Bool("keep-old") {
+		log.Infof("Old token %s kept, delete it once clients have switched", old.AccessorID)
+		return
+	}
+	if grace := c.Duration("grace"); grace > 0 {
+		log.Infof("Deleting old token %s in %s", old.AccessorID, grace)
+		time.Sleep(grace)
+	}
+	if _, err = cfg.client.ACL().TokenDelete(old.AccessorID, cfg.writeOpts); err != nil {
+		log.Fatalf("Could not delete old token %s: %v", old.AccessorID, err)
+	}
+	log.Println("Success")
+}
+
+// readTokenInfo reads a token along with its roles and every policy
+// that applies to it, directly or through a role
+func readTokenInfo(cfg *AppConfig, accessor string) (*tokenInfo, error) {
+	t, err := readToken(cfg, accessor)
+	if err != nil {
+		return nil, err
+	}
+	return resolveTokenInfo(cfg, t)
+}
+
+// resolveTokenInfo reads the roles and policies linked to a token. Reading
+// them needs acl:read, which the token itself usually doesn't have.
+func resolveTokenInfo(cfg *AppConfig, t *api.ACLToken) (*tokenInfo, error) {
+	var err error
+	info := &tokenInfo{
+		Token:             t,
+		ServiceIdentities: t.ServiceIdentities,
+		NodeIdentities:    t.NodeIdentities,
+	}
+
+	seen := map[string]bool{}
+	addPolicies := func(links []*api.ACLLink, via string) error {
+		for _, l := range links {
+			if seen[l.ID] {
+				continue
+			}
+			p, _, err := cfg.client.ACL().PolicyRead(l.ID, cfg.queryOpts)
+			if err != nil {
+				return fmt.Errorf("could not read policy %s: %v", l.Name, err)
+			}
+			if p == nil {
+				continue
+			}
+			seen[l.ID] = true
+			info.Policies = append(info.Policies, &effectivePolicy{Policy: p, Via: via})
+		}
+		return nil
+	}
+
+	if err = addPolicies(t.Policies, "token"); err != nil {
+		return nil, err
+	}
+	for _, l := range t.Roles {
+		r, _, err := cfg.client.ACL().RoleRead(l.ID, cfg.queryOpts)
+		if err != nil {
+			return nil, fmt.Errorf("could not read role %s: %v", l.Name, err)
+		}
+		if r == nil {
+			continue
+		}
+		info.Roles = append(info.Roles, r)
+		info.ServiceIdentities = append(info.ServiceIdentities, r.ServiceIdentities...)
+		info.NodeIdentities = append(info.NodeIdentities, r.NodeIdentities...)
+		if err = addPolicies(r.Policies, "role "+r.Name); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func printTokenInfo(c *cli.Context, info *tokenInfo) {
+	if useJsonOutput(c) {
+		// Output like this ends up in tickets and CI logs, so the
+		// secret is only included when asked for
+		if !c.Bool("show-secret") {
+			redacted := *info
+			token := *info.Token
+			token.SecretID = ""
+			redacted.Token = &token
+			info = &redacted
+		}
+		dumpJson(info)
+		return
+	}
+
+	t := info.Token
+	w := getTabwriter()
+	fmt.Fprintf(w, "AccessorID:\t%s\n", t.AccessorID)
+	fmt.Fprintf(w, "Description:\t%s\n", t.Description)
+	fmt.Fprintf(w, "Local:\t%v\n", t.Local)
+	if len(t.AuthMethod) > 0 {
+		fmt.Fprintf(w, "AuthMethod:\t%s\n", t.AuthMethod)
+	}
+	fmt.Fprintf(w, "Created:\t%s (%s ago)\n", t.CreateTime.Format(time.RFC3339), time.Since(t.CreateTime).Round(time.Second))
+	fmt.Fprintf(w, "Expires:\t%s\n", formatTokenExpiry(t.ExpirationTime))
+	fmt.Fprintf(w, "Roles:\t%s\n", formatACLLinks(t.Roles))
+	fmt.Fprintf(w, "ServiceIdentities:\t%s\n", formatServiceIdentities(info.ServiceIdentities))
+	fmt.Fprintf(w, "NodeIdentities:\t%s\n", formatNodeIdentities(info.NodeIdentities))
+	w.Flush()
+
+	if len(t.Rules) > 0 {
+		fmt.Printf("\nLegacy rules:\n%s\n", strings.TrimRight(t.Rules, "\n"))
+	}
+
+	fmt.Println()
+	w = getTabwriter()
+	fmt.Fprintf(w, "Policy\tVia\tDatacenters\n")
+	for _, p := range info.Policies {
+		dcs := strings.Join(p.Policy.Datacenters, ",")
+		if len(dcs) < 1 {
+			dcs = "all"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", p.Policy.Name, p.Via, dcs)
+	}
+	w.Flush()
+
+	for _, p := range info.Policies {
+		if len(strings.TrimSpace(p.Policy.Rules)) < 1 {
+			continue
+		}
+		fmt.Printf("\n# %s\n%s\n", p.Policy.Name, strings.TrimRight(p.Policy.Rules, "\n"))
+	}
+}
+
+func formatTokenExpiry(t *time.Time) string {
+	if t == nil {
+		return "never"
+	}
+	left := time.Until(*t).Round(time.Second)
+	if left <= 0 {
+		return fmt.Sprintf("%s (expired)", t.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("%s (in %s)", t.Format(time.RFC3339), left)
+}
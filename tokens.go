@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"regexp"
+	"strings"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func CreateToken(c *cli.Context) {
+	token := &api.ACLToken{
+		AccessorID: c.String("accessor"),
+		SecretID:   c.String("secret"),
+		Local:      c.Bool("local"),
+	}
+	if err := applyTokenFlags(c, token); err != nil {
+		log.Errorf("Invalid token: %v", err)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	t, _, err := cfg.client.ACL().TokenCreate(token, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not create token: %v", err)
+	}
+	printToken(c, t)
+}
+
+func ReadToken(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("accessor ID or 'self' is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	t, err := readToken(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read token: %v", err)
+	}
+	printToken(c, t)
+}
+
+func UpdateToken(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("accessor ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	// Start from the current token so unset flags keep their values
+	token, err := readToken(cfg, c.Args().First())
+	if err != nil {
+		log.Fatalf("Could not read token: %v", err)
+	}
+	if err = applyTokenFlags(c, token); err != nil {
+		log.Fatalf("Invalid token: %v", err)
+	}
+
+	t, _, err := cfg.client.ACL().TokenUpdate(token, cfg.writeOpts)
+	if err != nil {
+		log.Fatalf("Could not update token: %v", err)
+	}
+	printToken(c, t)
+}
+
+func DeleteToken(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("accessor ID is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	if _, err = cfg.client.ACL().TokenDelete(c.Args().First(), cfg.writeOpts); err != nil {
+		log.Fatalf("Could not delete token: %v", err)
+	}
+	log.Println("Success")
+}
+
+func ListTokens(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	tokens, _, err := cfg.client.ACL().TokenList(cfg.queryOpts)
+	if err != nil {
+		log.Fatalf("Could not list tokens: %v", err)
+	}
+
+	if useJsonOutput(c) {
+		dumpJson(tokens)
+		return
+	}
+	prettyPrintTokenList(tokens)
+}
+
+// readToken reads a token by accessor ID, or the token in use for "self"
+func readToken(cfg *AppConfig, accessor string) (*api.ACLToken, error) {
+	if accessor == "self" {
+		t, _, err := cfg.client.ACL().TokenReadSelf(cfg.queryOpts)
+		return t, err
+	}
+	t, _, err := cfg.client.ACL().TokenRead(accessor, cfg.queryOpts)
+	if err == nil && t == nil {
+		err = fmt.Errorf("token %s not found", accessor)
+	}
+	return t, err
+}
+
+// applyTokenFlags copies the flags that were set onto the token
+func applyTokenFlags(c *cli.Context, token *api.ACLToken) error {
+	if c.IsSet("description") {
+		token.Description = c.String("description")
+	}
+	if c.IsSet("policy") {
+		token.Policies = aclLinks(c.StringSlice("policy"))
+	}
+	if c.IsSet("role") {
+		token.Roles = aclLinks(c.StringSlice("role"))
+	}
+	if c.IsSet("service-identity") {
+		ids, err := parseServiceIdentities(c.StringSlice("service-identity"))
+		if err != nil {
+			return err
+		}
+		token.ServiceIdentities = ids
+	}
+	if c.IsSet("node-identity") {
+		ids, err := parseNodeIdentities(c.StringSlice("node-identity"), c.GlobalString("datacenter"))
+		if err != nil {
+			return err
+		}
+		token.NodeIdentities = ids
+	}
+	if c.IsSet("ttl") {
+		token.ExpirationTTL = c.Duration("ttl")
+	}
+	return nil
+}
+
+func printToken(c *cli.Context, t *api.ACLToken) {
+	if useJsonOutput(c) {
+		dumpJson(t)
+		return
+	}
+	prettyPrintToken(t)
+}
+
+// aclLinks treats values that look like UUIDs as IDs and everything else as names
+func aclLinks(values []string) []*api.ACLLink {
+	links := []*api.ACLLink{}
+	for _, v := range values {
+		if uuidPattern.MatchString(v) {
+			links = append(links, &api.ACLLink{ID: v})
+			continue
+		}
+		links = append(links, &api.ACLLink{Name: v})
+	}
+	return links
+}
+
+// parseServiceIdentities parses service-name[:dc1,dc2] values
+func parseServiceIdentities(values []string) ([]*api.ACLServiceIdentity, error) {
+	ids := []*api.ACLServiceIdentity{}
+	for _, v := range values {
+		split := strings.SplitN(v, ":", 2)
+		if len(split[0]) < 1 {
+			return nil, fmt.Errorf("invalid service identity %q", v)
+		}
+		id := &api.ACLServiceIdentity{ServiceName: split[0]}
+		if len(split) > 1 && len(split[1]) > 0 {
+			id.Datacenters = strings.Split(split[1], ",")
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// parseNodeIdentities parses node-name[:dc] values, defaulting to dc
+func parseNodeIdentities(values []string, dc string) ([]*api.ACLNodeIdentity, error) {
+	ids := []*api.ACLNodeIdentity{}
+	for _, v := range values {
+		split := strings.SplitN(v, ":", 2)
+		if len(split[0]) < 1 {
+			return nil, fmt.Errorf("invalid node identity %q", v)
+		}
+		id := &api.ACLNodeIdentity{NodeName: split[0], Datacenter: dc}
+		if len(split) > 1 && len(split[1]) > 0 {
+			id.Datacenter = split[1]
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
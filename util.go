@@ -1,13 +1,18 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"github.com/codegangsta/cli"
 	"github.com/hashicorp/consul/api"
 	log "github.com/sirupsen/logrus"
 	"os"
+	"os/exec"
+	"sort"
 	"strings"
 	"text/tabwriter"
+	"time"
 )
 
 func getTabwriter() *tabwriter.Writer {
@@ -49,24 +54,257 @@ func prettyPrintACLs(acls []*api.ACLEntry) {
 	w.Flush()
 }
 
-func prettyPrintEvents(events []*api.UserEvent) {
+// useJsonOutput is true when --format json or the global --verbose flag is set
+func useJsonOutput(c *cli.Context) bool {
+	return c.GlobalBool("verbose") || c.String("format") == "json"
+}
+
+func formatACLLinks(links []*api.ACLLink) string {
+	names := []string{}
+	for _, l := range links {
+		if len(l.Name) > 0 {
+			names = append(names, l.Name)
+			continue
+		}
+		names = append(names, l.ID)
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatServiceIdentities(ids []*api.ACLServiceIdentity) string {
+	results := []string{}
+	for _, id := range ids {
+		if len(id.Datacenters) > 0 {
+			results = append(results, id.ServiceName+" ("+strings.Join(id.Datacenters, ",")+")")
+			continue
+		}
+		results = append(results, id.ServiceName)
+	}
+	return strings.Join(results, ", ")
+}
+
+func formatNodeIdentities(ids []*api.ACLNodeIdentity) string {
+	results := []string{}
+	for _, id := range ids {
+		results = append(results, id.NodeName+" ("+id.Datacenter+")")
+	}
+	return strings.Join(results, ", ")
+}
+
+func prettyPrintToken(t *api.ACLToken) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "AccessorID:\t%s\n", t.AccessorID)
+	fmt.Fprintf(w, "SecretID:\t%s\n", t.SecretID)
+	fmt.Fprintf(w, "Description:\t%s\n", t.Description)
+	fmt.Fprintf(w, "Local:\t%v\n", t.Local)
+	if len(t.AuthMethod) > 0 {
+		fmt.Fprintf(w, "AuthMethod:\t%s\n", t.AuthMethod)
+	}
+	fmt.Fprintf(w, "CreateTime:\t%s\n", t.CreateTime.Format(time.RFC3339))
+	if t.ExpirationTime != nil {
+		fmt.Fprintf(w, "ExpirationTime:\t%s\n", t.ExpirationTime.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Policies:\t%s\n", formatACLLinks(t.Policies))
+	fmt.Fprintf(w, "Roles:\t%s\n", formatACLLinks(t.Roles))
+	fmt.Fprintf(w, "ServiceIdentities:\t%s\n", formatServiceIdentities(t.ServiceIdentities))
+	fmt.Fprintf(w, "NodeIdentities:\t%s\n", formatNodeIdentities(t.NodeIdentities))
+	w.Flush()
+}
+
+func prettyPrintTokenList(tokens []*api.ACLTokenListEntry) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "AccessorID\tDescription\tPolicies\tRoles\tLocal\tExpires\n")
+	for _, t := range tokens {
+		expires := ""
+		if t.ExpirationTime != nil {
+			expires = t.ExpirationTime.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%v\t%s\n",
+			t.AccessorID, t.Description, formatACLLinks(t.Policies), formatACLLinks(t.Roles), t.Local, expires)
+	}
+	w.Flush()
+}
+
+func prettyPrintPolicy(p *api.ACLPolicy) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID:\t%s\n", p.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", p.Name)
+	fmt.Fprintf(w, "Description:\t%s\n", p.Description)
+	fmt.Fprintf(w, "Datacenters:\t%s\n", strings.Join(p.Datacenters, ", "))
+	w.Flush()
+	fmt.Printf("Rules:\n%s\n", strings.TrimRight(p.Rules, "\n"))
+}
+
+func prettyPrintPolicyList(policies []*api.ACLPolicyListEntry) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID\tName\tDescription\tDatacenters\n")
+	for _, p := range policies {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", p.ID, p.Name, p.Description, strings.Join(p.Datacenters, ","))
+	}
+	w.Flush()
+}
+
+func prettyPrintRole(r *api.ACLRole) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID:\t%s\n", r.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", r.Name)
+	fmt.Fprintf(w, "Description:\t%s\n", r.Description)
+	fmt.Fprintf(w, "Policies:\t%s\n", formatACLLinks(r.Policies))
+	fmt.Fprintf(w, "ServiceIdentities:\t%s\n", formatServiceIdentities(r.ServiceIdentities))
+	fmt.Fprintf(w, "NodeIdentities:\t%s\n", formatNodeIdentities(r.NodeIdentities))
+	w.Flush()
+}
+
+func prettyPrintRoleList(roles []*api.ACLRole) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID\tName\tDescription\tPolicies\tServiceIdentities\n")
+	for _, r := range roles {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			r.ID, r.Name, r.Description, formatACLLinks(r.Policies), formatServiceIdentities(r.ServiceIdentities))
+	}
+	w.Flush()
+}
+
+func prettyPrintReplicationStatus(dcs []string, statuses map[string]*api.ACLReplicationStatus) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "Datacenter\tEnabled\tRunning\tSource\tType\tIndex\tTokenIndex\tRoleIndex\tLastSuccess\tLastError\n")
+	for _, dc := range dcs {
+		s, ok := statuses[dc]
+		if !ok {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%v\t%v\t%s\t%s\t%d\t%d\t%d\t%s\t%s\n",
+			dc, s.Enabled, s.Running, s.SourceDatacenter, s.ReplicationType,
+			s.ReplicatedIndex, s.ReplicatedTokenIndex, s.ReplicatedRoleIndex,
+			formatReplicationTime(s.LastSuccess), formatReplicationTime(s.LastError))
+	}
+	w.Flush()
+}
+
+func prettyPrintAuthMethod(m *api.ACLAuthMethod) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "Name:\t%s\n", m.Name)
+	fmt.Fprintf(w, "Type:\t%s\n", m.Type)
+	fmt.Fprintf(w, "DisplayName:\t%s\n", m.DisplayName)
+	fmt.Fprintf(w, "Description:\t%s\n", m.Description)
+	fmt.Fprintf(w, "MaxTokenTTL:\t%s\n", m.MaxTokenTTL)
+	fmt.Fprintf(w, "TokenLocality:\t%s\n", m.TokenLocality)
+	w.Flush()
+	config, _ := json.MarshalIndent(m.Config, "", "  ")
+	fmt.Printf("Config:\n%s\n", config)
+}
+
+func prettyPrintAuthMethodList(methods []*api.ACLAuthMethodListEntry) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "Name\tType\tDisplayName\tDescription\tMaxTokenTTL\n")
+	for _, m := range methods {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", m.Name, m.Type, m.DisplayName, m.Description, m.MaxTokenTTL)
+	}
+	w.Flush()
+}
+
+func prettyPrintBindingRule(r *api.ACLBindingRule) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID:\t%s\n", r.ID)
+	fmt.Fprintf(w, "AuthMethod:\t%s\n", r.AuthMethod)
+	fmt.Fprintf(w, "Description:\t%s\n", r.Description)
+	fmt.Fprintf(w, "Selector:\t%s\n", r.Selector)
+	fmt.Fprintf(w, "BindType:\t%s\n", r.BindType)
+	fmt.Fprintf(w, "BindName:\t%s\n", r.BindName)
+	w.Flush()
+}
+
+func prettyPrintBindingRuleList(rules []*api.ACLBindingRule) {
 	w := getTabwriter()
-	fmt.Fprintf(w, "ID\tName\tPayload\tNodeFilter\tServiceFilter\tTagFilter\n")
+	fmt.Fprintf(w, "ID\tAuthMethod\tBindType\tBindName\tSelector\n")
+	for _, r := range rules {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.ID, r.AuthMethod, r.BindType, r.BindName, r.Selector)
+	}
+	w.Flush()
+}
+
+func prettyPrintEvents(events []*api.UserEvent, payloadFormat string) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID\tName\tLTime\tPayloadAge\tNodeFilter\tServiceFilter\tTagFilter\tPayload\n")
 	for _, e := range events {
-		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", e.ID, e.Name, string(e.Payload), e.NodeFilter, e.ServiceFilter, e.TagFilter)
+		payload := decodeEventPayload(e.Payload, payloadFormat)
+		// Pretty JSON doesn't fit in a row, it goes under the table
+		if payloadFormat == "json" {
+			payload = ""
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\t%s\n",
+			e.ID, e.Name, e.LTime, formatAge(eventAge(e)), e.NodeFilter, e.ServiceFilter, e.TagFilter, payload)
 	}
 	w.Flush()
+
+	if payloadFormat != "json" {
+		return
+	}
+	for _, e := range events {
+		if len(e.Payload) > 0 {
+			fmt.Printf("\n# %s (%s)\n%s\n", e.ID, e.Name, decodeEventPayload(e.Payload, payloadFormat))
+		}
+	}
 }
 
 func prettyPrintChecks(checks map[string]*api.AgentCheck) {
+	ids := []string{}
+	for id := range checks {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
 	w := getTabwriter()
 	fmt.Fprintf(w, "ID\tName\tNode\tService\tStatus\tNotes\n")
-	for _, c := range checks {
+	for _, id := range ids {
+		c := checks[id]
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.CheckID, c.Name, c.Node, c.ServiceID, c.Status, c.Notes)
 	}
 	w.Flush()
 }
 
+func prettyPrintCheck(c *api.AgentCheck) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "ID:\t%s\n", c.CheckID)
+	fmt.Fprintf(w, "Name:\t%s\n", c.Name)
+	fmt.Fprintf(w, "Node:\t%s\n", c.Node)
+	fmt.Fprintf(w, "Service:\t%s\n", c.ServiceID)
+	fmt.Fprintf(w, "Type:\t%s\n", c.Type)
+	fmt.Fprintf(w, "Status:\t%s\n", c.Status)
+	fmt.Fprintf(w, "Notes:\t%s\n", c.Notes)
+	w.Flush()
+	fmt.Printf("Output:\n%s\n", strings.TrimRight(c.Output, "\n"))
+}
+
+func prettyPrintCheckHistory(history []*checkTransition) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "Time\tPrevious\tStatus\tOutput\n")
+	for _, t := range history {
+		// Only the first line of output fits in a table
+		output := strings.SplitN(strings.TrimSpace(t.Output), "\n", 2)[0]
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Time.Format(time.RFC3339), t.Previous, t.Status, output)
+	}
+	w.Flush()
+}
+
+func prettyPrintHealthChecks(checks api.HealthChecks) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "Node\tID\tName\tService\tStatus\tNotes\n")
+	for _, c := range checks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", c.Node, c.CheckID, c.Name, c.ServiceName, c.Status, c.Notes)
+	}
+	w.Flush()
+}
+
+func prettyPrintHealthSummary(summary []*healthSummary) {
+	w := getTabwriter()
+	fmt.Fprintf(w, "Service\tPassing\tWarning\tCritical\tOther\n")
+	for _, s := range summary {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\n", s.Service, s.Passing, s.Warning, s.Critical, s.Other)
+	}
+	w.Flush()
+}
+
 func prettyPrintServices(svcs []*api.CatalogService) {
 	w := getTabwriter()
 	fmt.Fprintf(w, "ID\tName\tNode\tAddress\tPort\tTags\n")
@@ -155,6 +393,107 @@ func stringArrayContains(s string, l []string) bool {
 	return false
 }
 
+// blockingQueryOpts copies the base query options and sets
+// the wait index and time for a blocking query
+func blockingQueryOpts(q *api.QueryOptions, index uint64, wait time.Duration) *api.QueryOptions {
+	opts := *q
+	opts.WaitIndex = index
+	opts.WaitTime = wait
+	return &opts
+}
+
+// runHook runs a shell command with the given stdin and extra environment
+func runHook(command string, stdin []byte, env []string) error {
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), env...)
+	return cmd.Run()
+}
+
+// parseKeyValues turns a list of key=value strings into a map
+func parseKeyValues(pairs []string) (map[string]string, error) {
+	if len(pairs) < 1 {
+		return nil, nil
+	}
+	results := map[string]string{}
+	for _, p := range pairs {
+		split := strings.SplitN(p, "=", 2)
+		if len(split) < 2 || len(split[0]) < 1 {
+			return nil, fmt.Errorf("expected key=value, got %q", p)
+		}
+		results[split[0]] = split[1]
+	}
+	return results, nil
+}
+
+// Consul's config files use snake_case keys while the api structs use Go
+// field names. These are the words that become acronyms, and the keys
+// whose json tags don't follow the field name.
+var (
+	consulKeyAcronyms = map[string]string{"id": "ID", "http": "HTTP", "tcp": "TCP", "ttl": "TTL", "tls": "TLS", "grpc": "GRPC"}
+	consulKeyAliases  = map[string]string{"args": "ScriptArgs", "script_args": "ScriptArgs"}
+
+	// Maps whose keys are user data, such as header names, not fields
+	consulUserMaps = map[string]bool{"Meta": true, "Header": true, "TaggedAddresses": true, "Config": true}
+)
+
+// consulFieldName turns a config file key like deregister_critical_service_after
+// into the api field name DeregisterCriticalServiceAfter
+func consulFieldName(key string) string {
+	if alias, ok := consulKeyAliases[strings.ToLower(key)]; ok {
+		return alias
+	}
+	if !strings.Contains(key, "_") && strings.ToLower(key) != key {
+		// Already a field name, e.g. DeregisterCriticalServiceAfter
+		return key
+	}
+	name := ""
+	for _, part := range strings.Split(strings.ToLower(key), "_") {
+		if acronym, ok := consulKeyAcronyms[part]; ok {
+			name += acronym
+		} else if len(part) > 0 {
+			name += strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return name
+}
+
+// normalizeConsulKeys rewrites the keys of decoded JSON to api field names
+func normalizeConsulKeys(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		results := map[string]interface{}{}
+		for k, val := range t {
+			name := consulFieldName(k)
+			if consulUserMaps[name] {
+				results[name] = val
+				continue
+			}
+			results[name] = normalizeConsulKeys(val)
+		}
+		return results
+	case []interface{}:
+		for i := range t {
+			t[i] = normalizeConsulKeys(t[i])
+		}
+	}
+	return v
+}
+
+// decodeConsulDefinition decodes JSON in Consul's config file format into
+// an api struct, failing on keys it doesn't know rather than dropping them
+func decodeConsulDefinition(v interface{}, out interface{}) error {
+	b, err := json.Marshal(normalizeConsulKeys(v))
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(out)
+}
+
 func marshalPrettyKey(p *api.KVPair) ([]byte, error) {
 	xmog := &struct {
 		Key         string
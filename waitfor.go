@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"strings"
+	"time"
+)
+
+// waitCondition checks a condition once. Conditions backed by a blocking
+// query wait for index to change before answering and return the new index.
+type waitCondition struct {
+	name  string
+	index uint64
+	check func(q *api.QueryOptions) (bool, uint64, error)
+}
+
+// WaitFor blocks until every condition is met or the timeout expires
+func WaitFor(c *cli.Context) {
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	conditions := []*waitCondition{}
+	if len(c.String("service")) > 0 {
+		conditions = append(conditions, waitForService(cfg, c.String("service"), c.String("tag"), c.Int("passing")))
+	}
+	if len(c.String("key")) > 0 {
+		conditions = append(conditions, waitForKey(cfg, c.String("key"), c.String("value"), c.IsSet("value")))
+	}
+	if len(c.String("check")) > 0 {
+		conditions = append(conditions, waitForCheck(cfg, c.String("check"), c.String("status")))
+	}
+	if c.Bool("leader") {
+		conditions = append(conditions, waitForLeader(cfg))
+	}
+	if len(conditions) < 1 {
+		log.Errorln("At least one of --service, --key, --check or --leader is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	deadline := time.Now().Add(c.Duration("timeout"))
+	for {
+		// Check everything without blocking, then block on the
+		// first condition that isn't met yet
+		var pending *waitCondition
+		for _, cond := range conditions {
+			met, index, err := cond.check(cfg.queryOpts)
+			if err != nil {
+				log.Debugf("%s: %v", cond.name, err)
+			}
+			cond.index = index
+			if !met {
+				pending = cond
+				break
+			}
+		}
+		if pending == nil {
+			log.Println("Success")
+			return
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			log.Fatalf("Timed out waiting for %s", pending.name)
+		}
+		log.Infof("Waiting for %s", pending.name)
+
+		wait := remaining
+		if wait > c.Duration("wait") {
+			wait = c.Duration("wait")
+		}
+		if _, _, err := pending.check(blockingQueryOpts(cfg.queryOpts, pending.index, wait)); err != nil {
+			// Don't spin on a failing or unreachable agent
+			time.Sleep(time.Second)
+		}
+	}
+}
+
+func waitForService(cfg *AppConfig, name, tag string, passing int) *waitCondition {
+	return &waitCondition{
+		name: fmt.Sprintf("%d passing instances of %s", passing, name),
+		check: func(q *api.QueryOptions) (bool, uint64, error) {
+			entries, meta, err := cfg.client.Health().Service(name, tag, true, q)
+			if err != nil {
+				return false, 0, err
+			}
+			return len(entries) >= passing, meta.LastIndex, nil
+		},
+	}
+}
+
+func waitForKey(cfg *AppConfig, key, value string, matchValue bool) *waitCondition {
+	key = strings.TrimPrefix(key, "/")
+	name := "key " + key
+	if matchValue {
+		name += " = " + value
+	}
+	return &waitCondition{
+		name: name,
+		check: func(q *api.QueryOptions) (bool, uint64, error) {
+			pair, meta, err := cfg.client.KV().Get(key, q)
+			if err != nil {
+				return false, 0, err
+			}
+			if pair == nil {
+				return false, meta.LastIndex, nil
+			}
+			return !matchValue || string(pair.Value) == value, meta.LastIndex, nil
+		},
+	}
+}
+
+func waitForCheck(cfg *AppConfig, id, status string) *waitCondition {
+	return &waitCondition{
+		name: fmt.Sprintf("check %s to be %s", id, status),
+		check: func(q *api.QueryOptions) (bool, uint64, error) {
+			checks, meta, err := cfg.client.Health().State(api.HealthAny, q)
+			if err != nil {
+				return false, 0, err
+			}
+			found := false
+			for _, hc := range checks {
+				if hc.CheckID != id {
+					continue
+				}
+				if hc.Status != status {
+					return false, meta.LastIndex, nil
+				}
+				found = true
+			}
+			return found, meta.LastIndex, nil
+		},
+	}
+}
+
+// waitForLeader polls since the status endpoints don't support blocking queries
+func waitForLeader(cfg *AppConfig) *waitCondition {
+	return &waitCondition{
+		name: "a cluster leader",
+		check: func(q *api.QueryOptions) (bool, uint64, error) {
+			leader, err := cfg.client.Status().Leader()
+			if err == nil && len(leader) > 0 {
+				return true, 0, nil
+			}
+			if q.WaitTime > 0 {
+				time.Sleep(time.Second)
+			}
+			return false, 0, err
+		},
+	}
+}
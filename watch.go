@@ -0,0 +1,168 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/hashicorp/consul/api"
+	log "github.com/sirupsen/logrus"
+	"sort"
+	"time"
+)
+
+// instanceChange describes a single service instance that joined,
+// left or changed status between two blocking query results
+type instanceChange struct {
+	Time     time.Time `json:"time"`
+	Change   string    `json:"change"`
+	Service  string    `json:"service"`
+	ID       string    `json:"id"`
+	Node     string    `json:"node"`
+	Address  string    `json:"address"`
+	Port     int       `json:"port"`
+	Status   string    `json:"status"`
+	Previous string    `json:"previous,omitempty"`
+}
+
+type instanceState struct {
+	entry  *api.ServiceEntry
+	status string
+}
+
+func WatchService(c *cli.Context) {
+	if len(c.Args().First()) < 1 {
+		log.Errorln("service name is required")
+		cli.ShowAppHelp(c)
+		log.Exit(2)
+	}
+
+	format := c.String("format")
+	if format != "table" && format != "json" {
+		log.Errorf("Unknown format %q, must be table or json", format)
+		log.Exit(2)
+	}
+
+	// Get client
+	cfg, err := NewAppConfig(c)
+	if err != nil {
+		log.Fatalf("Failed to get client: %v", err)
+	}
+
+	name := c.Args().First()
+	health := cfg.client.Health()
+	known := map[string]*instanceState{}
+	var index uint64
+
+	for {
+		entries, meta, err := health.Service(name, c.String("tag"), c.Bool("passing"),
+			blockingQueryOpts(cfg.queryOpts, index, c.Duration("wait")))
+		if err != nil {
+			log.Errorf("Failed to query service health: %v", err)
+			time.Sleep(c.Duration("retry"))
+			continue
+		}
+
+		// Reset the index if it goes backwards, as the docs recommend
+		if meta.LastIndex < index {
+			index = 0
+			continue
+		}
+		index = meta.LastIndex
+
+		changes := diffServiceEntries(name, known, entries)
+		if len(changes) < 1 {
+			continue
+		}
+
+		printInstanceChanges(changes, format)
+
+		if len(c.String("exec")) > 0 {
+			payload, _ := json.Marshal(changes)
+			if err := runHook(c.String("exec"), payload, []string{
+				"CONSUL_SERVICE=" + name,
+				fmt.Sprintf("CONSUL_INDEX=%d", index),
+			}); err != nil {
+				log.Errorf("Exec hook failed: %v", err)
+			}
+		}
+	}
+}
+
+// diffServiceEntries updates known with the current entries and returns
+// the instances that joined, left or changed status
+func diffServiceEntries(name string, known map[string]*instanceState, entries []*api.ServiceEntry) []*instanceChange {
+	now := time.Now()
+	changes := []*instanceChange{}
+	seen := map[string]bool{}
+
+	newChange := func(kind string, e *api.ServiceEntry, status string) *instanceChange {
+		return &instanceChange{
+			Time:    now,
+			Change:  kind,
+			Service: name,
+			ID:      e.Service.ID,
+			Node:    e.Node.Node,
+			Address: serviceEntryAddress(e),
+			Port:    e.Service.Port,
+			Status:  status,
+		}
+	}
+
+	for _, e := range entries {
+		key := e.Node.Node + "/" + e.Service.ID
+		status := e.Checks.AggregatedStatus()
+		seen[key] = true
+
+		prev, ok := known[key]
+		if !ok {
+			changes = append(changes, newChange("joined", e, status))
+		} else if prev.status != status {
+			ch := newChange("changed", e, status)
+			ch.Previous = prev.status
+			changes = append(changes, ch)
+		}
+		known[key] = &instanceState{entry: e, status: status}
+	}
+
+	for key, prev := range known {
+		if seen[key] {
+			continue
+		}
+		ch := newChange("left", prev.entry, prev.status)
+		changes = append(changes, ch)
+		delete(known, key)
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Node != changes[j].Node {
+			return changes[i].Node < changes[j].Node
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes
+}
+
+func printInstanceChanges(changes []*instanceChange, format string) {
+	if format == "json" {
+		for _, ch := range changes {
+			out, err := json.Marshal(ch)
+			if err != nil {
+				log.Errorf("Could not marshal JSON: %v", err)
+				continue
+			}
+			fmt.Println(string(out))
+		}
+		return
+	}
+
+	w := getTabwriter()
+	for _, ch := range changes {
+		status := ch.Status
+		if len(ch.Previous) > 0 {
+			status = ch.Previous + " -> " + ch.Status
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s:%d\t%s\n",
+			ch.Time.Format(time.RFC3339), ch.Change, ch.Node, ch.ID, ch.Address, ch.Port, status)
+	}
+	w.Flush()
+}